@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/entries"
+)
+
+// blame shows which files and lines an entry, and each of its tags, came from.
+// Decks written by merge -provenance keep the sources of the original files.
+func blame(args []string) {
+	flags := flag.NewFlagSet("blame", flag.ExitOnError)
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		log.Fatalf("Need at least 1 file and a term to blame")
+	}
+	term := flags.Arg(flags.NArg() - 1)
+
+	merged := input.loadMerged(flags.Args()[:flags.NArg()-1], match.matcher, *jobs)
+	found := entries.FindTerm(term, merged)
+	if len(found) == 0 {
+		log.Fatalf("No entries found for %s", term)
+	}
+	for _, e := range found {
+		fmt.Println(e.ToString())
+		for _, s := range e.Sources {
+			fmt.Printf("\t%s\t%s\n", s.Location(), strings.Join(s.Tags, " "))
+		}
+	}
+}
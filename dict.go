@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/jmdict"
+	"github.com/nrb/csvmerger/pkg/stream"
+)
+
+// dict runs one of the dictionary subcommands.
+func dict(args []string) {
+	if len(args) < 1 {
+		log.Fatalf("Need a dict subcommand, like check")
+	}
+	switch args[0] {
+	case "index":
+		dictIndex(args[1:])
+	case "check":
+		dictCheck(args[1:])
+	case "pos":
+		dictPOS(args[1:])
+	default:
+		log.Fatalf("Unknown dict subcommand %s", args[0])
+	}
+}
+
+// addJMdictFlag adds the -jmdict flag to a command's flags.
+func addJMdictFlag(flags *flag.FlagSet) *string {
+	return flags.String("jmdict", "", "JMdict XML file, which may be compressed; it's indexed the first time it's used")
+}
+
+// openJMdict opens the dictionary given with -jmdict.
+func openJMdict(path string) *jmdict.Dictionary {
+	if path == "" {
+		log.Fatalf("Need a -jmdict file")
+	}
+	d, err := jmdict.Open(path)
+	if ierr, ok := err.(*jmdict.IndexError); ok {
+		fmt.Fprintf(os.Stderr, "Warning: %s; it will be parsed again next time\n", ierr)
+	} else if err != nil {
+		log.Fatalf("Error loading JMdict: %s", err)
+	}
+	return d
+}
+
+// dictIndex indexes a JMdict file, so later commands using it start quickly.
+func dictIndex(args []string) {
+	flags := flag.NewFlagSet("dict index", flag.ExitOnError)
+	path := addJMdictFlag(flags)
+	flags.Parse(args)
+
+	if *path == "" {
+		log.Fatalf("Need a -jmdict file")
+	}
+	d, err := jmdict.Index(*path)
+	if err != nil {
+		log.Fatalf("Error indexing JMdict: %s", err)
+	}
+	fmt.Printf("Indexed %d entries to %s\n", len(d.Entries), jmdict.IndexPath(*path))
+}
+
+// dictCheck checks decks against JMdict.
+func dictCheck(args []string) {
+	flags := flag.NewFlagSet("dict check", flag.ExitOnError)
+	path := addJMdictFlag(flags)
+	readings := flags.Bool("readings", false, "list the readings of entries written in kanji")
+	format := flags.String("format", "text", "output format: text, json, or sarif for code scanning tools")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file to check")
+	}
+	d := openJMdict(*path)
+
+	var diags []diagnostic.Diagnostic
+	for _, e := range input.loadMerged(flags.Args(), match.matcher, *jobs) {
+		diags = append(diags, d.Check(e, *readings)...)
+	}
+	if *format == "text" {
+		for _, diag := range diags {
+			fmt.Println(diag)
+		}
+	} else if err := diagnostic.Write(os.Stdout, *format, jmdict.Rules, diags); err != nil {
+		log.Fatalf("Error writing problems: %s", err)
+	}
+}
+
+// dictPOS tags entries with their parts of speech from JMdict.
+func dictPOS(args []string) {
+	flags := flag.NewFlagSet("dict pos", flag.ExitOnError)
+	path := addJMdictFlag(flags)
+	prefix := flags.String("prefix", "pos", "tag to put the parts of speech below, as in pos::v1")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	output := addOutputFlags(flags)
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file to tag")
+	}
+	d := openJMdict(*path)
+
+	merged := input.loadMerged(flags.Args(), match.matcher, *jobs)
+	for _, e := range merged {
+		for _, pos := range d.POS(e) {
+			if *prefix != "" {
+				pos = *prefix + "::" + pos
+			}
+			e.Tags.Insert(pos)
+		}
+	}
+	output.write(stream.Slice(merged))
+}
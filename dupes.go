@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/fuzzy"
+	"github.com/nrb/csvmerger/pkg/types"
+)
+
+// dupes lists entries that appear more than once across the files, or with
+// -fuzzy, pairs of entries that are nearly the same, such as typos.
+func dupes(args []string) {
+	flags := flag.NewFlagSet("dupes", flag.ExitOnError)
+	isFuzzy := flags.Bool("fuzzy", false, "list near-duplicates, most similar first, instead of exact duplicates")
+	japaneseDistance := flags.Int("japanese-distance", 1, "with -fuzzy, the most characters the Japanese of near-duplicates may differ by")
+	englishDistance := flags.Int("english-distance", 2, "with -fuzzy, the most characters the English of near-duplicates may differ by")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file")
+	}
+	if *japaneseDistance < 0 || *englishDistance < 0 {
+		log.Fatalf("Distances can't be negative")
+	}
+
+	merged := input.loadMerged(flags.Args(), match.matcher, *jobs)
+	if !*isFuzzy {
+		for _, e := range merged {
+			if len(e.Sources) > 1 {
+				fmt.Printf("%s\t%s\n", e.ToString(), sourceLocations(e))
+			}
+		}
+		return
+	}
+
+	pairs := fuzzy.FindPairs(merged, fuzzy.Options{
+		JapaneseDistance: *japaneseDistance,
+		EnglishDistance:  *englishDistance,
+	})
+	for _, p := range pairs {
+		fmt.Printf("%.2f\n", p.Similarity)
+		for _, e := range []*types.Entry{p.A, p.B} {
+			fmt.Printf("\t%s\t%s\n", e.ToString(), sourceLocations(e))
+		}
+	}
+}
+
+// sourceLocations returns the files and lines an entry came from.
+func sourceLocations(e *types.Entry) string {
+	locations := make([]string, len(e.Sources))
+	for i, s := range e.Sources {
+		locations[i] = s.Location()
+	}
+	return strings.Join(locations, " ")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/stream"
+	"github.com/nrb/csvmerger/pkg/wordlist"
+	"github.com/pkg/errors"
+)
+
+// enrich tags entries from word lists, like those of JLPT levels, and a
+// frequency list.
+func enrich(args []string) {
+	flags := flag.NewFlagSet("enrich", flag.ExitOnError)
+	lists := &wordlistFlag{}
+	flags.Var(lists, "wordlist", "FILE:TAG, a list of words, one per line, whose entries get TAG, like n5.txt:jlpt::n5; may be repeated")
+	frequencyPath := flags.String("frequency", "", "list of words, one per line, most frequent first, to tag entries with their frequency band")
+	bandsArg := flags.String("bands", "1000,2000,5000,10000,20000", "highest rank of each frequency band")
+	frequencyTag := flags.String("frequency-tag", "freq", "tag to put frequency bands below, as in freq::1000")
+	reportPath := flags.String("report", "", "file to write entries on no list, or several word lists, to instead of standard error")
+	reportFormat := flags.String("report-format", "text", "format of the -report file: text, json, or sarif")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	output := addOutputFlags(flags)
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file to enrich")
+	}
+	if len(lists.lists) == 0 && *frequencyPath == "" {
+		log.Fatalf("Need a -wordlist or -frequency list")
+	}
+	bands, err := wordlist.ParseBands(*bandsArg)
+	if err != nil {
+		log.Fatalf("Error with -bands: %s", err)
+	}
+	enricher := &wordlist.Enricher{Lists: lists.lists, Bands: bands, FrequencyTag: *frequencyTag}
+	if *frequencyPath != "" {
+		if enricher.Frequency, err = wordlist.LoadFrequency(*frequencyPath); err != nil {
+			log.Fatalf("Error loading frequency list: %s", err)
+		}
+	}
+
+	merged := input.loadMerged(flags.Args(), match.matcher, *jobs)
+	var diags []diagnostic.Diagnostic
+	for _, e := range merged {
+		diags = append(diags, enricher.Enrich(e)...)
+	}
+	writeEnrichReport(*reportPath, *reportFormat, diags)
+	output.write(stream.Slice(merged))
+}
+
+// writeEnrichReport writes the problems found by enrich to a file, or to
+// standard error as text if path is empty.
+func writeEnrichReport(path, format string, diags []diagnostic.Diagnostic) {
+	if path == "" {
+		for _, d := range diags {
+			fmt.Fprintln(os.Stderr, d)
+		}
+		return
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Error writing report: %s", err)
+	}
+	if format == "text" {
+		for _, d := range diags {
+			fmt.Fprintln(out, d)
+		}
+	} else if err := diagnostic.Write(out, format, wordlist.Rules, diags); err != nil {
+		log.Fatalf("Error writing report: %s", err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("Error writing report: %s", err)
+	}
+}
+
+// wordlistFlag is a flag that loads a word list along with the tag its
+// entries get.
+type wordlistFlag struct {
+	args  []string
+	lists []*wordlist.List
+}
+
+func (f *wordlistFlag) String() string {
+	return strings.Join(f.args, ",")
+}
+
+func (f *wordlistFlag) Set(arg string) error {
+	path, tag := splitWordlistArg(arg)
+	if path == "" || tag == "" {
+		return errors.Errorf("Expected FILE:TAG, got %s", arg)
+	}
+	l, err := wordlist.LoadList(path, tag)
+	if err != nil {
+		return err
+	}
+	f.args = append(f.args, arg)
+	f.lists = append(f.lists, l)
+	return nil
+}
+
+// splitWordlistArg splits FILE:TAG at the first single colon, since tags
+// may be hierarchical, as in n5.txt:jlpt::n5.
+func splitWordlistArg(arg string) (string, string) {
+	for i := 0; i < len(arg); i++ {
+		if arg[i] != ':' {
+			continue
+		}
+		if i+1 < len(arg) && arg[i+1] == ':' {
+			i++
+			continue
+		}
+		return arg[:i], arg[i+1:]
+	}
+	return arg, ""
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"runtime"
+
+	"github.com/nrb/csvmerger/pkg/query"
+	"github.com/nrb/csvmerger/pkg/stream"
+)
+
+// filter writes the entries whose tags match a tag expression.
+func filter(args []string) {
+	flags := flag.NewFlagSet("filter", flag.ExitOnError)
+	tags := flags.String("tags", "", "tag expression entries must match, like 'lesson:3..7 and not verb'")
+	output := addOutputFlags(flags)
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if *tags == "" {
+		log.Fatalf("Need a -tags expression")
+	}
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file to filter")
+	}
+	expr := parseQuery("tags", *tags)
+
+	merged := input.loadMerged(flags.Args(), match.matcher, *jobs)
+	output.write(stream.Slice(query.Select(expr, merged)))
+}
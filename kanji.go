@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"runtime"
+
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/kanji"
+)
+
+// kanjiReport lists the kanji used in a deck, grouped using KANJIDIC2,
+// along with the entries using each.
+func kanjiReport(args []string) {
+	flags := flag.NewFlagSet("kanji", flag.ExitOnError)
+	dictPath := flags.String("kanjidic", "", "KANJIDIC2 XML file, which may be compressed")
+	groupBy := flags.String("group-by", "grade", "group kanji by grade, jlpt or strokes")
+	format := flags.String("format", "csv", "output format, csv or html")
+	output := flags.String("o", file.Stdin, "file to write the report to; compressed if it ends in .gz")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if *dictPath == "" {
+		log.Fatalf("Need a -kanjidic file")
+	}
+	if *format != "csv" && *format != "html" {
+		log.Fatalf("Unknown format %s, expected csv or html", *format)
+	}
+	by, err := kanji.ParseGroupBy(*groupBy)
+	if err != nil {
+		log.Fatalf("Error with -group-by: %s", err)
+	}
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file")
+	}
+	d, err := kanji.LoadDictionary(*dictPath)
+	if err != nil {
+		log.Fatalf("Error loading KANJIDIC2: %s", err)
+	}
+
+	groups := kanji.Groups(kanji.Extract(input.loadMerged(flags.Args(), match.matcher, *jobs), d), by)
+	out, err := file.Create(*output)
+	if err != nil {
+		log.Fatalf("Error with output %s: %s", *output, err)
+	}
+	if *format == "html" {
+		err = kanji.WriteHTML(out, groups)
+	} else {
+		err = kanji.WriteCSV(out, groups)
+	}
+	if err != nil {
+		log.Fatalf("Error with output %s: %s", *output, err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("Error with output %s: %s", *output, err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/lint"
+	"github.com/nrb/csvmerger/pkg/schema"
+	"github.com/nrb/csvmerger/pkg/types"
+)
+
+// lintDecks checks decks for common mistakes, exiting with an error if any
+// findings are errors.
+func lintDecks(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	configPath := flags.String("config", "", "file setting the severity of lint rules")
+	schemaPath := flags.String("schema", "", "tag schema file the entries' tags must follow")
+	fix := flags.Bool("fix", false, "rewrite files, fixing the problems that can be fixed safely")
+	listRules := flags.Bool("rules", false, "list the lint rules and exit")
+	format := flags.String("format", "text", "output format: text, json, or sarif for code scanning tools")
+	provenance := addProvenanceInputFlag(flags)
+	tagOrder := addTagOrderFlag(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if *listRules {
+		for _, r := range lint.Rules {
+			fixable := ""
+			if r.Fix != nil {
+				fixable = ", fixable"
+			}
+			fmt.Printf("%s (%s%s): %s\n", r.ID, r.Severity, fixable, r.Description)
+		}
+		return
+	}
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file to lint")
+	}
+
+	var config lint.Config
+	if *configPath != "" {
+		var err error
+		config, err = lint.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Error loading lint config: %s", err)
+		}
+	}
+	// The -match flag wins over the config.
+	if flagSet(flags, "match") {
+		config.Matcher = match.matcher
+	}
+	linter := lint.New(config)
+	if *schemaPath != "" {
+		s, err := schema.Load(*schemaPath)
+		if err != nil {
+			log.Fatalf("Error loading schema: %s", err)
+		}
+		linter.Schema = s
+	}
+
+	files, err := file.ExpandPaths(flags.Args())
+	if err != nil {
+		log.Fatalf("Error finding files: %s", err)
+	}
+	var findings []lint.Finding
+	for _, path := range files {
+		if *fix && path == file.Stdin {
+			log.Fatalf("Can't fix standard input")
+		}
+		f, err := lint.Load(path, *provenance)
+		if err != nil {
+			log.Fatalf("Error loading files: %s", err)
+		}
+		if *fix && fixLintFile(f, linter, tagOrder.order) {
+			// Reload, so findings have the line numbers of the fixed file.
+			if f, err = lint.Load(path, *provenance); err != nil {
+				log.Fatalf("Error loading files: %s", err)
+			}
+		}
+		findings = append(findings, linter.Check(f)...)
+	}
+
+	failed := false
+	diags := make([]diagnostic.Diagnostic, len(findings))
+	for i, finding := range findings {
+		diags[i] = finding.Diagnostic()
+		if finding.Severity == lint.Error {
+			failed = true
+		}
+	}
+	if *format == "text" {
+		for _, finding := range findings {
+			fmt.Println(finding)
+		}
+	} else if err := diagnostic.Write(os.Stdout, *format, lint.DiagnosticRules(), diags); err != nil {
+		log.Fatalf("Error writing findings: %s", err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// fixLintFile fixes the problems in a file that can be fixed safely and
+// rewrites it, returning true if it was rewritten. Only the fixed lines
+// change, with tags in order; the rest are written as they were. The file
+// is only replaced once it's been written in full.
+func fixLintFile(f *lint.File, linter *lint.Linter, order types.TagOrder) bool {
+	if linter.Fix(f) == 0 {
+		return false
+	}
+	err := file.Replace(f.Path, func(w io.Writer) error {
+		return f.Write(w, order)
+	})
+	if err != nil {
+		log.Fatalf("Error with output %s: %s", f.Path, err)
+	}
+	return true
+}
+
+// flagSet reports whether a flag was given on the command line.
+func flagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -1,62 +1,371 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/nrb/csvmerger/pkg/entries"
 	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/query"
+	"github.com/nrb/csvmerger/pkg/romaji"
+	"github.com/nrb/csvmerger/pkg/stream"
+	"github.com/nrb/csvmerger/pkg/tagrules"
 	"github.com/nrb/csvmerger/pkg/types"
 )
 
+const usage = `Usage:
+	csvmerger merge [-match exact|normalized|japanese|english|reading] [flags] FILE...
+	csvmerger blame [flags] FILE... TERM
+	csvmerger filter -tags EXPR [flags] FILE...
+	csvmerger tags rewrite -rules RULES [flags] FILE...
+	csvmerger intersect|subtract|symdiff [flags] DECK DECK
+	csvmerger split -by-tag PATTERN -out DIR [flags] FILE...
+	csvmerger stats [-format text|json] [flags] FILE...
+	csvmerger lint [-config FILE] [-schema FILE] [-match NAME] [-fix] FILE...
+	csvmerger dupes [-fuzzy] [flags] FILE...
+	csvmerger dict index|check|pos -jmdict JMDICT [flags] FILE...
+	csvmerger enrich -wordlist FILE:TAG -frequency FILE [flags] FILE...
+	csvmerger kanji -kanjidic KANJIDIC2 [-group-by grade|jlpt|strokes] [-format csv|html] [flags] FILE...
+
+Run a command with -h to see its flags.`
+
 func main() {
 
-	if len(os.Args) < 3 {
-		log.Fatalf("Need at least 2 files to merge")
-		return
+	if len(os.Args) < 2 {
+		log.Fatalf("Need a command\n%s", usage)
+	}
+
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "merge":
+		merge(args)
+	case "blame":
+		blame(args)
+	case "filter":
+		filter(args)
+	case "tags":
+		tags(args)
+	case "intersect":
+		intersect(args)
+	case "subtract":
+		subtract(args)
+	case "symdiff":
+		symdiff(args)
+	case "split":
+		split(args)
+	case "stats":
+		deckStats(args)
+	case "lint":
+		lintDecks(args)
+	case "dupes":
+		dupes(args)
+	case "dict":
+		dict(args)
+	case "enrich":
+		enrich(args)
+	case "kanji":
+		kanjiReport(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Println(usage)
+	default:
+		log.Fatalf("Unknown command %s\n%s", os.Args[1], usage)
+	}
+}
+
+// inputFlags are the flags controlling how decks are read.
+type inputFlags struct {
+	provenance *bool
+	rules      *tagRulesFlag
+	tagFiles   *tagFileFlag
+	romaji     *bool
+}
+
+// addInputFlags adds the flags controlling how decks are read.
+func addInputFlags(flags *flag.FlagSet) *inputFlags {
+	return &inputFlags{
+		provenance: addProvenanceInputFlag(flags),
+		rules:      addTagRulesFlag(flags),
+		tagFiles:   addTagFileFlag(flags),
+		romaji:     flags.Bool("romaji-input", false, "convert Japanese written in romaji, like machi, to hiragana as it's loaded"),
+	}
+}
+
+// addProvenanceInputFlag adds the -provenance-input flag to a command's flags.
+func addProvenanceInputFlag(flags *flag.FlagSet) *bool {
+	return flags.Bool("provenance-input", false, "read the sources column of decks written with -provenance, so entries keep the files and lines they first came from")
+}
+
+// loadMerged loads the files named by args and merges the entries that
+// match according to m, without checking for redefinitions.
+func (in *inputFlags) loadMerged(args []string, m types.Matcher, jobs int) []*types.Entry {
+	files, opts := in.expand(args)
+	return mergeFiles(files, opts, m, jobs)
+}
+
+// expand expands args to the files to load, along with the options to read
+// them with, which give the tags to add to and remove from each file's entries.
+func (in *inputFlags) expand(args []string) ([]string, file.Options) {
+	files, edits, err := file.ExpandInputs(args)
+	if err != nil {
+		log.Fatalf("Error finding files: %s", err)
+	}
+	return files, file.Options{
+		// Tags given with a file on the command line win over the -tag-file.
+		Edits:   append(append(file.TagEdits{}, in.tagFiles.edits...), edits...),
+		Sources: *in.provenance,
+		Rules:   in.rules.rules,
+		Romaji:  *in.romaji,
 	}
+}
 
-	files := os.Args[2:]
-	if len(files) < 2 {
-		log.Fatalf("Need at least 2 files to merge")
+// mergeFiles loads files and merges the entries that match according to m,
+// without checking for redefinitions.
+func mergeFiles(files []string, opts file.Options, m types.Matcher, jobs int) []*types.Entry {
+	loaded, err := file.LoadAll(files, opts, jobs)
+	if err != nil {
+		log.Fatalf("Error loading files: %s", err)
 	}
 
 	var merged []*types.Entry
-	redefs := make(map[string][]*types.Entry)
+	for _, es := range loaded {
+		merged = entries.MergeBy(m, merged, es)
+	}
+	return merged
+}
+
+// parseQuery parses a tag expression given by a flag.
+func parseQuery(name, expr string) query.Expr {
+	e, err := query.Parse(expr)
+	if err != nil {
+		log.Fatalf("Invalid -%s expression: %s", name, err)
+	}
+	return e
+}
+
+// formatFlags are the flags controlling how a deck is written.
+type formatFlags struct {
+	provenance *bool
+	flatTags   *string
+	romaji     *romajiFlag
+	tagOrder   *tagOrderFlag
+}
+
+// addFormatFlags adds the flags controlling how a deck is written.
+func addFormatFlags(flags *flag.FlagSet) *formatFlags {
+	return &formatFlags{
+		provenance: flags.Bool("provenance", false, "add a column listing the file, line and tags each entry came from"),
+		flatTags:   flags.String("flatten-tags", "", "flatten hierarchical tags by joining their levels with this, like _ for jlpt_n5"),
+		romaji:     addRomajiFlag(flags),
+		tagOrder:   addTagOrderFlag(flags),
+	}
+}
+
+// writeFile writes all entries from it to a file. Output is compressed or
+// tab-separated based on the file's name.
+func (f *formatFlags) writeFile(output string, it stream.Iterator) {
+	out, err := file.Create(output)
+	if err != nil {
+		log.Fatalf("Error with output %s: %s", output, err)
+	}
+	if err := f.writeEntries(out, file.Separator(output), it); err != nil {
+		log.Fatalf("Error with output %s: %s", output, err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("Error with output %s: %s", output, err)
+	}
+}
 
-	for i := 0; i < len(files); i++ {
-		// Load the entries
-		es, err := file.CSVToEntries(files[i])
+// replaceFile rewrites an existing file with all entries from it, like
+// writeFile. The file is only replaced once it's been written in full.
+func (f *formatFlags) replaceFile(path string, it stream.Iterator) {
+	err := file.Replace(path, func(w io.Writer) error {
+		return f.writeEntries(w, file.Separator(path), it)
+	})
+	if err != nil {
+		log.Fatalf("Error with output %s: %s", path, err)
+	}
+}
+
+// writeEntries writes all entries from it to out, with fields joined by sep.
+func (f *formatFlags) writeEntries(out io.Writer, sep string, it stream.Iterator) error {
+	w := file.NewWriter(out, sep)
+	w.Sources = *f.provenance
+	w.FlatTagSeparator = *f.flatTags
+	w.Romaji = f.romaji.system
+	w.TagOrder = f.tagOrder.order
+	for {
+		e, err := it.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			log.Fatalf("Error with file %s: %s", files[i], err)
+			return err
 		}
-
-		// Look for redefinitions
-		for _, e := range es {
-			rds, ok := entries.FindRedefinition(e, merged)
-			if ok {
-				key := fmt.Sprintf("%s:%s", files[i], e.ToString())
-				redefs[key] = rds
-			}
+		if err := w.Write(e); err != nil {
+			return err
 		}
-		merged = entries.Merge(merged, es)
 	}
+	return w.Flush()
+}
+
+// outputFlags are the flags of commands that write a single deck.
+type outputFlags struct {
+	*formatFlags
+	path *string
+}
+
+// addOutputFlags adds the flags controlling where and how a deck is written.
+func addOutputFlags(flags *flag.FlagSet) *outputFlags {
+	return &outputFlags{
+		formatFlags: addFormatFlags(flags),
+		path:        flags.String("o", file.Stdin, "file to write the deck to; compressed if it ends in .gz or .zst"),
+	}
+}
 
-	if len(redefs) > 0 {
-		fmt.Println("Redefintions were found, can't merge")
-		for key, vals := range redefs {
-			fmt.Println(key)
-			for _, v := range vals {
-				fmt.Printf("\t%s\n", v.ToString())
-			}
+// write writes all entries from it to the output file.
+func (o *outputFlags) write(it stream.Iterator) {
+	o.writeFile(*o.path, it)
+}
+
+// tagOrderFlag is a flag that sets the order tags are written in.
+type tagOrderFlag struct {
+	order types.TagOrder
+}
+
+func (f *tagOrderFlag) String() string {
+	if f.order == types.LexicalOrder {
+		return "lexical"
+	}
+	return "natural"
+}
+
+func (f *tagOrderFlag) Set(name string) error {
+	order, err := types.ParseTagOrder(name)
+	if err != nil {
+		return err
+	}
+	f.order = order
+	return nil
+}
+
+// addTagOrderFlag adds the -tag-order flag to a command's flags.
+func addTagOrderFlag(flags *flag.FlagSet) *tagOrderFlag {
+	f := &tagOrderFlag{}
+	flags.Var(f, "tag-order", "order to write tags in: natural (2 before 10) or lexical (10 before 2) (default natural)")
+	return f
+}
+
+// tagRulesFlag is a flag that loads a tag rules file, which then rewrites
+// every tag as it's loaded.
+type tagRulesFlag struct {
+	path  string
+	rules types.TagRewriter
+}
+
+func (f *tagRulesFlag) String() string {
+	return f.path
+}
+
+func (f *tagRulesFlag) Set(path string) error {
+	rules, err := tagrules.Load(path)
+	if err != nil {
+		return err
+	}
+	f.path = path
+	f.rules = rules
+	return nil
+}
+
+// addTagRulesFlag adds the -tag-rules flag to a command's flags.
+func addTagRulesFlag(flags *flag.FlagSet) *tagRulesFlag {
+	f := &tagRulesFlag{}
+	flags.Var(f, "tag-rules", "file of rules renaming, aliasing, removing and rewriting tags as they're loaded")
+	return f
+}
+
+// tagFileFlag is a flag that loads a file of tags to add to and remove from
+// the entries of matching input files.
+type tagFileFlag struct {
+	paths []string
+	edits file.TagEdits
+}
+
+func (f *tagFileFlag) String() string {
+	return strings.Join(f.paths, ",")
+}
+
+func (f *tagFileFlag) Set(path string) error {
+	edits, err := file.LoadTagEdits(path)
+	if err != nil {
+		return err
+	}
+	f.paths = append(f.paths, path)
+	f.edits = append(f.edits, edits...)
+	return nil
+}
+
+// addTagFileFlag adds the -tag-file flag to a command's flags.
+func addTagFileFlag(flags *flag.FlagSet) *tagFileFlag {
+	f := &tagFileFlag{}
+	flags.Var(f, "tag-file", "file of input file patterns and the tags to add to (+TAG) or remove from (-TAG) their entries; may be repeated")
+	return f
+}
+
+// matchFlag is a flag that sets how entries are matched with each other.
+type matchFlag struct {
+	matcher types.Matcher
+}
+
+func (f *matchFlag) String() string {
+	for name, m := range types.Matchers {
+		if m == f.matcher {
+			return name
 		}
-		fmt.Println("Redefintions were found, can't merge")
-		return
 	}
+	return "exact"
+}
 
-	for _, m := range merged {
-		fmt.Println(m.ToString())
+func (f *matchFlag) Set(name string) error {
+	m, err := types.ParseMatcher(name)
+	if err != nil {
+		return err
 	}
+	f.matcher = m
+	return nil
+}
+
+// addMatchFlag adds the -match flag to a command's flags.
+func addMatchFlag(flags *flag.FlagSet) *matchFlag {
+	f := &matchFlag{matcher: types.ExactMatcher}
+	flags.Var(f, "match", "how entries match: exact, normalized (ignoring case and spacing), japanese, english, or reading (Japanese in kana or romaji) (default exact)")
+	return f
+}
+
+// romajiFlag is a flag that adds a column with the Japanese of each entry
+// spelled in romaji.
+type romajiFlag struct {
+	system romaji.System
+}
+
+func (f *romajiFlag) String() string {
+	return f.system.String()
+}
+
+func (f *romajiFlag) Set(name string) error {
+	system, err := romaji.ParseSystem(name)
+	if err != nil {
+		return err
+	}
+	f.system = system
+	return nil
+}
 
+func addRomajiFlag(flags *flag.FlagSet) *romajiFlag {
+	f := &romajiFlag{}
+	flags.Var(f, "romaji", "add a last column with the Japanese spelled in romaji, hepburn or kunrei, for flashcard apps")
+	return f
 }
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/entries"
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/implied"
+	"github.com/nrb/csvmerger/pkg/lint"
+	"github.com/nrb/csvmerger/pkg/schema"
+	"github.com/nrb/csvmerger/pkg/script"
+	"github.com/nrb/csvmerger/pkg/stream"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// merge merges decks into one, refusing to if any terms are redefined.
+func merge(args []string) {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := addOutputFlags(flags)
+	streaming := flags.Bool("stream", false, "merge with bounded memory, for decks too large to load at once; output, and any redefinitions reported, are sorted by key rather than input order")
+	chunkSize := flags.Int("chunk-size", 100000, "most entries held in memory at once with -stream")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	where := flags.String("where", "", "only write entries whose tags match this tag expression")
+	schemaPath := flags.String("schema", "", "tag schema file the merged entries' tags must follow")
+	impliedPath := flags.String("implied", "", "file of rules adding implied tags to the merged entries")
+	explain := flags.Bool("explain", false, "print which implied tag rule added which tag to which entry")
+	swapReversed := flags.Bool("swap-reversed", false, "swap the columns of files with their Japanese and English the wrong way round, instead of refusing to merge")
+	report := &mergeReport{
+		path:   flags.String("diagnostics", "", "write problems found while merging to this file instead of printing them"),
+		format: flags.String("diagnostics-format", "json", "format of the -diagnostics file, json or sarif"),
+	}
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	files, opts := input.expand(flags.Args())
+	if len(files) < 2 {
+		log.Fatalf("Need at least 2 files to merge")
+	}
+	if *report.format != "json" && *report.format != "sarif" {
+		log.Fatalf("Unknown diagnostics format %s, expected json or sarif", *report.format)
+	}
+	defer report.write()
+	keep := func(*types.Entry) bool { return true }
+	if *where != "" {
+		expr := parseQuery("where", *where)
+		keep = func(e *types.Entry) bool { return expr.Match(e.Tags) }
+	}
+
+	// Merged entries get their implied tags, then are checked against the schema.
+	var violations []schema.Violation
+	var checks []func(*types.Entry)
+	if *impliedPath != "" {
+		rules, err := implied.Load(*impliedPath)
+		if err != nil {
+			log.Fatalf("Error loading implied tag rules: %s", err)
+		}
+		checks = append(checks, func(e *types.Entry) {
+			additions := rules.Apply(e)
+			if *explain {
+				for _, a := range additions {
+					fmt.Fprintln(os.Stderr, a)
+				}
+			}
+		})
+	}
+	if *schemaPath != "" {
+		tagSchema, err := schema.Load(*schemaPath)
+		if err != nil {
+			log.Fatalf("Error loading schema: %s", err)
+		}
+		checks = append(checks, func(e *types.Entry) {
+			violations = append(violations, tagSchema.Validate(e)...)
+		})
+	}
+	check := func(e *types.Entry) {
+		for _, c := range checks {
+			c(e)
+		}
+	}
+
+	if *streaming {
+		// Files are counted for reversal as they're merged, after any
+		// swapping, so they're only read once. Swapping needs to know which
+		// files are reversed before merging though, so with -swap-reversed
+		// they're read twice. Standard input can only be read once, so it's
+		// never swapped, and stops the merge if it looks reversed.
+		var swap []reversalCheck
+		if *swapReversed {
+			its := make([]stream.Iterator, len(files))
+			for i := range files {
+				its[i] = stream.Slice(nil)
+				if files[i] != file.Stdin {
+					its[i] = stream.Files(files[i:i+1], opts)
+				}
+			}
+			swap = reversedFiles(files, its, report)
+		}
+		counters := make([]reversalCheck, len(files))
+		its := make([]stream.Iterator, len(files))
+		for i := range files {
+			its[i] = stream.Files(files[i:i+1], opts)
+			if swap != nil && swap[i].Reversed() {
+				its[i] = stream.Map(its[i], swapIfSwapped)
+			}
+			its[i] = stream.Map(its[i], counters[i].add)
+		}
+		opts := stream.Options{ChunkSize: *chunkSize, Inspect: check, Duplicate: report.duplicate, Matcher: match.matcher}
+		reversed := func() bool {
+			report.swapped(counters)
+			return report.reversed(files, counters)
+		}
+		mergeStreaming(stream.Concat(its...), opts, reversed, &violations, keep, output, report)
+		return
+	}
+
+	// Load the entries
+	loaded, err := file.LoadAll(files, opts, *jobs)
+	if err != nil {
+		report.fatal("Error loading files", err)
+	}
+	its := make([]stream.Iterator, len(files))
+	for i := range loaded {
+		its[i] = stream.Slice(loaded[i])
+	}
+	reversed := reversedFiles(files, its, report)
+	report.swapped(reversed)
+	if !*swapReversed && report.reversed(files, reversed) {
+		return
+	}
+	for i := range loaded {
+		if reversed[i].Reversed() {
+			for _, e := range loaded[i] {
+				swapIfSwapped(e)
+			}
+		}
+	}
+
+	var merged []*types.Entry
+	var redefs []redefinition
+	seen := make(map[string]int)
+
+	for _, es := range loaded {
+		// Merge one entry at a time, so entries are checked against
+		// earlier entries of their own file too.
+		for _, e := range es {
+			rds, ok := entries.FindRedefinitionBy(match.matcher, e, merged)
+			if ok {
+				key := fmt.Sprintf("%s:%s", types.Locations(e.Sources), e.ToString())
+				if i, ok := seen[key]; ok {
+					redefs[i].redefined = rds
+				} else {
+					seen[key] = len(redefs)
+					redefs = append(redefs, redefinition{e, rds})
+				}
+			}
+			if kept, ok := entries.FindBy(match.matcher, e, merged); ok {
+				report.duplicate(kept, e)
+			}
+			merged = entries.MergeBy(match.matcher, merged, []*types.Entry{e})
+		}
+	}
+
+	if report.redefinitions(redefs) {
+		return
+	}
+
+	for _, e := range merged {
+		check(e)
+	}
+	if len(violations) > 0 {
+		report.violations(violations)
+		return
+	}
+
+	output.write(stream.Filter(stream.Slice(merged), keep))
+}
+
+// mergeStreaming merges the entries of it without loading them into memory.
+// Merging stops if reversed reports any reversed files once all entries
+// have been read, or if opts.Inspect adds any schema violations. Only
+// entries for which keep returns true are written.
+func mergeStreaming(it stream.Iterator, opts stream.Options, reversed func() bool, violations *[]schema.Violation, keep func(*types.Entry) bool, output *outputFlags, report *mergeReport) {
+	merged, err := stream.Merge(it, opts)
+	if err != nil {
+		report.fatal("Error merging", err)
+	}
+	defer merged.Close()
+	if reversed() {
+		return
+	}
+
+	var redefs []redefinition
+	for _, group := range merged.Redefinitions {
+		for i, e := range group[1:] {
+			redefs = append(redefs, redefinition{e, group[:i+1]})
+		}
+	}
+	if report.redefinitions(redefs) {
+		return
+	}
+
+	if len(*violations) > 0 {
+		report.violations(*violations)
+		return
+	}
+
+	output.write(stream.Filter(merged, keep))
+}
+
+// reversedFiles counts the entries of each file that look swapped, to find
+// files written with their columns the wrong way round. its holds an
+// Iterator over each file's entries.
+func reversedFiles(files []string, its []stream.Iterator, report *mergeReport) []reversalCheck {
+	counters := make([]reversalCheck, len(files))
+	for i, it := range its {
+		for {
+			e, err := it.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				report.fatal("Error loading files", err)
+			}
+			counters[i].add(e)
+		}
+	}
+	return counters
+}
+
+// reversalCheck counts the entries of a file that look swapped, like a
+// script.ReversalCounter, and keeps those of a file too small to tell
+// whether it's reversed, so they can be reported on their own.
+type reversalCheck struct {
+	script.ReversalCounter
+	swapped []swappedEntry
+}
+
+// swappedEntry is an entry that looks swapped, where it was read.
+type swappedEntry struct {
+	japanese, english string
+	location          diagnostic.Location
+}
+
+// add counts an entry. Swapped entries are only kept while the file is too
+// small, so at most script.MinReversedEntries are.
+func (c *reversalCheck) add(e *types.Entry) {
+	c.Add(e.Japanese, e.English)
+	if c.TooSmall() && script.Swapped(e.Japanese, e.English) {
+		c.swapped = append(c.swapped, swappedEntry{e.Japanese, e.English, diagnostic.FirstLocation(e.Sources)})
+	}
+}
+
+// swapIfSwapped swaps the columns of an entry that look swapped.
+func swapIfSwapped(e *types.Entry) {
+	if script.Swapped(e.Japanese, e.English) {
+		e.SwapFields()
+	}
+}
+
+// Rule names of the problems merge finds, besides tag schema violations.
+const (
+	redefinitionRule = "redefinition"
+	duplicateRule    = "duplicate-entry"
+	reversedRule     = "reversed-file"
+)
+
+// mergeRules describes the problems merge finds, for diagnostics.
+var mergeRules = []diagnostic.Rule{
+	{ID: lint.ParseErrorRule, Description: "a line isn't a valid entry"},
+	{ID: redefinitionRule, Description: "an entry gives a different English or Japanese text for a term"},
+	{ID: duplicateRule, Description: "an entry is repeated within a file"},
+	{ID: reversedRule, Description: "a file has its Japanese and English columns the wrong way round"},
+	{ID: lint.SwappedColumnsRule, Description: "an entry of a file too small to look reversed has its Japanese and English columns swapped"},
+	{ID: schema.UnknownTagRule, Description: schema.RuleDescriptions[schema.UnknownTagRule]},
+	{ID: schema.RequiredRule, Description: schema.RuleDescriptions[schema.RequiredRule]},
+	{ID: schema.ExclusiveRule, Description: schema.RuleDescriptions[schema.ExclusiveRule]},
+}
+
+// mergeReport reports the problems found while merging. Problems are
+// printed, unless a -diagnostics file is given, in which case they're
+// collected and written to it as diagnostics.
+type mergeReport struct {
+	path   *string
+	format *string
+	diags  []diagnostic.Diagnostic
+}
+
+func (r *mergeReport) enabled() bool {
+	return *r.path != ""
+}
+
+// duplicate warns about an entry repeated within a file, before the
+// duplicate's tags are merged into the entry kept. Entries repeated across
+// files are expected, so aren't reported.
+func (r *mergeReport) duplicate(kept, dup *types.Entry) {
+	same := types.SourcesInFiles(kept.Sources, dup.Sources)
+	if len(same) == 0 {
+		return
+	}
+	if r.enabled() {
+		r.diags = append(r.diags, diagnostic.Diagnostic{
+			Location: diagnostic.FirstLocation(types.SourcesInFiles(dup.Sources, kept.Sources)),
+			Rule:     duplicateRule,
+			Level:    diagnostic.Warning,
+			Message:  fmt.Sprintf("Duplicate entry %s,%s, its tags were merged", dup.Japanese, dup.English),
+			Related:  diagnostic.Locations(same),
+		})
+		return
+	}
+	locations := append(same, types.SourcesInFiles(dup.Sources, kept.Sources)...)
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].File != locations[j].File {
+			return locations[i].File < locations[j].File
+		}
+		return locations[i].Line < locations[j].Line
+	})
+	fmt.Fprintf(os.Stderr, "Duplicate entry %s,%s at %s, merging its tags\n", dup.Japanese, dup.English, types.Locations(locations))
+}
+
+// reversed reports the files that look reversed, returning true if there
+// are any.
+func (r *mergeReport) reversed(files []string, counters []reversalCheck) bool {
+	found := false
+	for i, c := range counters {
+		if !c.Reversed() {
+			continue
+		}
+		found = true
+		swapped, decided := c.Counts()
+		msg := fmt.Sprintf("%d of %d entries have their Japanese and English swapped", swapped, decided)
+		if r.enabled() {
+			r.diags = append(r.diags, diagnostic.Diagnostic{
+				Location: diagnostic.Location{File: file.SourceName(files[i])},
+				Rule:     reversedRule,
+				Level:    diagnostic.Error,
+				Message:  msg + "; merge with -swap-reversed to swap them back",
+			})
+			continue
+		}
+		fmt.Printf("%s looks reversed: %s\n", file.SourceName(files[i]), msg)
+	}
+	if found && !r.enabled() {
+		fmt.Println("Reversed files were found, can't merge; merge with -swap-reversed to swap them back")
+	}
+	return found
+}
+
+// swapped warns about the entries whose columns look swapped in files too
+// small to tell whether they're reversed. They don't stop the merge.
+func (r *mergeReport) swapped(counters []reversalCheck) {
+	for _, c := range counters {
+		if !c.TooSmall() {
+			continue
+		}
+		for _, e := range c.swapped {
+			r.swappedEntry(e)
+		}
+	}
+}
+
+// swappedEntry warns about an entry whose columns look swapped.
+func (r *mergeReport) swappedEntry(e swappedEntry) {
+	msg := fmt.Sprintf("Columns of %s,%s look swapped", e.japanese, e.english)
+	if r.enabled() {
+		r.diags = append(r.diags, diagnostic.Diagnostic{
+			Location: e.location,
+			Rule:     lint.SwappedColumnsRule,
+			Level:    diagnostic.Warning,
+			Message:  msg,
+		})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s at %s, merging it as it is\n", msg, e.location)
+}
+
+// redefinition is an entry giving a different English or Japanese text
+// for the terms of others.
+type redefinition struct {
+	entry     *types.Entry
+	redefined []*types.Entry
+}
+
+// redefinitions reports redefined terms, returning true if there are any.
+func (r *mergeReport) redefinitions(redefs []redefinition) bool {
+	if len(redefs) == 0 {
+		return false
+	}
+	if r.enabled() {
+		for _, rd := range redefs {
+			r.redefinition(rd.entry, rd.redefined)
+		}
+		return true
+	}
+	fmt.Println("Redefintions were found, can't merge")
+	for _, rd := range redefs {
+		fmt.Printf("%s:%s\n", types.Locations(rd.entry.Sources), rd.entry.ToString())
+		for _, v := range rd.redefined {
+			fmt.Printf("\t%s (%s)\n", v.ToString(), types.Locations(v.Sources))
+		}
+	}
+	fmt.Println("Redefintions were found, can't merge")
+	return true
+}
+
+// redefinition adds a diagnostic for an entry redefining others.
+func (r *mergeReport) redefinition(e *types.Entry, redefined []*types.Entry) {
+	d := diagnostic.Diagnostic{
+		Location: diagnostic.FirstLocation(e.Sources),
+		Rule:     redefinitionRule,
+		Level:    diagnostic.Error,
+	}
+	var others []string
+	for _, v := range redefined {
+		others = append(others, fmt.Sprintf("%s,%s", v.Japanese, v.English))
+		d.Related = append(d.Related, diagnostic.Locations(v.Sources)...)
+	}
+	d.Message = fmt.Sprintf("%s,%s redefines %s", e.Japanese, e.English, strings.Join(others, "; "))
+	r.diags = append(r.diags, d)
+}
+
+// violations reports tag schema violations.
+func (r *mergeReport) violations(violations []schema.Violation) {
+	if !r.enabled() {
+		fmt.Println("Tags don't follow the schema, can't merge")
+		for _, v := range violations {
+			fmt.Println(v)
+		}
+		fmt.Println("Tags don't follow the schema, can't merge")
+		return
+	}
+	for _, v := range violations {
+		d := diagnostic.Diagnostic{
+			Location: diagnostic.FirstLocation(v.Sources),
+			Rule:     v.Rule,
+			Level:    diagnostic.Error,
+			Message:  fmt.Sprintf("%s (%s)", v.Message, v.Entry.ToString()),
+		}
+		if len(v.Sources) > 1 {
+			d.Related = diagnostic.Locations(v.Sources[1:])
+		}
+		r.diags = append(r.diags, d)
+	}
+}
+
+// fatal reports an error that stops the merge, as a diagnostic if it's a
+// parse error, then exits.
+func (r *mergeReport) fatal(msg string, err error) {
+	if perr, ok := errors.Cause(err).(*file.ParseError); ok && r.enabled() {
+		r.diags = append(r.diags, diagnostic.Diagnostic{
+			Location: diagnostic.Location{File: perr.File, Line: perr.Line},
+			Rule:     lint.ParseErrorRule,
+			Level:    diagnostic.Error,
+			Message:  perr.Err.Error(),
+		})
+		r.write()
+		os.Exit(1)
+	}
+	log.Fatalf("%s: %s", msg, err)
+}
+
+// write writes the diagnostics file, if one was asked for. It's written
+// even if no problems were found.
+func (r *mergeReport) write() {
+	if !r.enabled() {
+		return
+	}
+	out, err := os.Create(*r.path)
+	if err != nil {
+		log.Fatalf("Error writing diagnostics: %s", err)
+	}
+	if err := diagnostic.Write(out, *r.format, mergeRules, r.diags); err != nil {
+		log.Fatalf("Error writing diagnostics: %s", err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("Error writing diagnostics: %s", err)
+	}
+}
@@ -0,0 +1,117 @@
+// Package diagnostic writes problems found in decks, such as lint findings
+// and redefinitions, in formats other tools can read.
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Level is how serious a Diagnostic is.
+type Level string
+
+const (
+	Error   Level = "error"
+	Warning Level = "warning"
+	Note    Level = "note"
+)
+
+// Location is a line of a file.
+type Location struct {
+	File string `json:"file"`
+	Line int    `json:"line,omitempty"`
+}
+
+func (l Location) String() string {
+	if l.Line == 0 {
+		return l.File
+	}
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// Locations returns the locations of sources.
+func Locations(sources []types.Source) []Location {
+	var locations []Location
+	for _, s := range sources {
+		locations = append(locations, Location{File: s.File, Line: s.Line})
+	}
+	return locations
+}
+
+// FirstLocation returns the location of the first of sources, the line an
+// entry was first read from.
+func FirstLocation(sources []types.Source) Location {
+	if len(sources) == 0 {
+		return Location{}
+	}
+	return Location{File: sources[0].File, Line: sources[0].Line}
+}
+
+// Diagnostic is a problem found on a line of a deck.
+type Diagnostic struct {
+	Location
+	Rule    string `json:"rule"`
+	Level   Level  `json:"level"`
+	Message string `json:"message"`
+	// Related are other lines involved in the problem, such as the entry
+	// a redefinition conflicts with.
+	Related []Location `json:"related,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("%s: %s: %s (%s)", d.Location, d.Level, d.Message, d.Rule)
+	if len(d.Related) > 0 {
+		related := make([]string, len(d.Related))
+		for i, r := range d.Related {
+			related[i] = r.String()
+		}
+		s += ", see " + strings.Join(related, ", ")
+	}
+	return s
+}
+
+// Rule describes a kind of Diagnostic.
+type Rule struct {
+	ID          string
+	Description string
+}
+
+// Formats are the names of the formats diagnostics can be written in.
+var Formats = []string{"text", "json", "sarif"}
+
+// Write writes diagnostics in a format: text, one per line; json, as
+// written by WriteJSON; or sarif, as written by WriteSARIF.
+func Write(w io.Writer, format string, rules []Rule, diags []Diagnostic) error {
+	switch format {
+	case "text":
+		for _, d := range diags {
+			if _, err := fmt.Fprintln(w, d); err != nil {
+				return errors.Wrap(err, "Error writing diagnostics")
+			}
+		}
+		return nil
+	case "json":
+		return WriteJSON(w, diags)
+	case "sarif":
+		return WriteSARIF(w, rules, diags)
+	}
+	return errors.Errorf("Unknown format %s, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// WriteJSON writes diagnostics as a JSON object, with a diagnostics field
+// holding the list of diagnostics.
+func WriteJSON(w io.Writer, diags []Diagnostic) error {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(struct {
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}{diags}), "Error writing diagnostics")
+}
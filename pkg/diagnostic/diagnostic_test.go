@@ -0,0 +1,113 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var diags = []Diagnostic{
+	{
+		Location: Location{File: "lessons/01.csv", Line: 4},
+		Rule:     "redefinition",
+		Level:    Error,
+		Message:  "まち,town redefines まち,city",
+		Related:  []Location{{File: "lessons/01.csv", Line: 1}},
+	},
+	{
+		Location: Location{File: "lessons/02.csv", Line: 2},
+		Rule:     "empty-tags",
+		Level:    Note,
+		Message:  "Entry has no tags",
+	},
+}
+
+func TestDiagnosticString(t *testing.T) {
+	assert.Equal(t, "lessons/01.csv:4: error: まち,town redefines まち,city (redefinition), see lessons/01.csv:1", diags[0].String())
+	assert.Equal(t, "lessons/02.csv:2: note: Entry has no tags (empty-tags)", diags[1].String())
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, diags))
+	assert.JSONEq(t, `{"diagnostics": [
+		{"file": "lessons/01.csv", "line": 4, "rule": "redefinition", "level": "error",
+		 "message": "まち,town redefines まち,city", "related": [{"file": "lessons/01.csv", "line": 1}]},
+		{"file": "lessons/02.csv", "line": 2, "rule": "empty-tags", "level": "note",
+		 "message": "Entry has no tags"}
+	]}`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteJSON(&buf, nil))
+	assert.JSONEq(t, `{"diagnostics": []}`, buf.String())
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	rules := []Rule{{ID: "redefinition", Description: "a term is redefined"}}
+	require.NoError(t, WriteSARIF(&buf, rules, diags))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+	assert.Equal(t, "csvmerger", run.Tool.Driver.Name)
+	// Rules that weren't described are added.
+	assert.Equal(t, []sarifRule{
+		{ID: "redefinition", ShortDescription: sarifMessage{Text: "a term is redefined"}},
+		{ID: "empty-tags", ShortDescription: sarifMessage{Text: "empty-tags"}},
+	}, run.Tool.Driver.Rules)
+
+	require.Len(t, run.Results, 2)
+	r := run.Results[0]
+	assert.Equal(t, "redefinition", r.RuleID)
+	assert.Equal(t, 0, r.RuleIndex)
+	assert.Equal(t, Error, r.Level)
+	assert.Equal(t, "lessons/01.csv", r.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, 4, r.Locations[0].PhysicalLocation.Region.StartLine)
+	require.Len(t, r.RelatedLocations, 1)
+	assert.Equal(t, 1, *r.RelatedLocations[0].ID)
+	assert.Equal(t, 1, r.RelatedLocations[0].PhysicalLocation.Region.StartLine)
+	assert.Equal(t, 1, run.Results[1].RuleIndex)
+	assert.Equal(t, Note, run.Results[1].Level)
+}
+
+func TestWriteSARIFWithoutFile(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteSARIF(&buf, nil, []Diagnostic{{
+		Rule:    "index",
+		Level:   Warning,
+		Message: "Couldn't write the index",
+		Related: []Location{{}, {File: "deck.csv", Line: 2}},
+	}}))
+	assert.NotContains(t, buf.String(), `"uri": ""`)
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	r := log.Runs[0].Results[0]
+	assert.Empty(t, r.Locations)
+	require.Len(t, r.RelatedLocations, 1)
+	assert.Equal(t, 1, *r.RelatedLocations[0].ID)
+	assert.Equal(t, "deck.csv", r.RelatedLocations[0].PhysicalLocation.ArtifactLocation.URI)
+}
+
+func TestSARIFURI(t *testing.T) {
+	assert.Equal(t, "lessons/my%20deck.csv", sarifURI("lessons/my deck.csv"))
+	assert.Equal(t, "file:///tmp/deck.csv", sarifURI("/tmp/deck.csv"))
+	assert.Equal(t, "stdin", sarifURI("stdin"))
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	assert.Error(t, Write(&bytes.Buffer{}, "xml", nil, diags))
+}
+
+func TestFirstLocation(t *testing.T) {
+	assert.Equal(t, Location{File: "a.csv", Line: 3},
+		FirstLocation([]types.Source{{File: "a.csv", Line: 3}, {File: "b.csv", Line: 1}}))
+	assert.Equal(t, Location{}, FirstLocation(nil))
+}
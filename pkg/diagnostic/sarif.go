@@ -0,0 +1,147 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The SARIF 2.1.0 log format, as far as it's needed to report diagnostics.
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            Level           `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifURI returns a file path as a URI. Relative paths stay relative, so
+// results line up with the files of a repository.
+func sarifURI(path string) string {
+	u := &url.URL{Path: filepath.ToSlash(path)}
+	if filepath.IsAbs(path) {
+		u.Scheme = "file"
+		if !strings.HasPrefix(u.Path, "/") {
+			u.Path = "/" + u.Path
+		}
+	}
+	return u.String()
+}
+
+func sarifLocationOf(l Location) sarifLocation {
+	loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: sarifURI(l.File)},
+	}}
+	if l.Line > 0 {
+		loc.PhysicalLocation.Region = &sarifRegion{StartLine: l.Line}
+	}
+	return loc
+}
+
+// WriteSARIF writes diagnostics as a SARIF 2.1.0 log, for code scanning
+// tools. rules describes the rules diagnostics may refer to; rules without
+// a description are added for any others.
+func WriteSARIF(w io.Writer, rules []Rule, diags []Diagnostic) error {
+	driver := sarifDriver{Name: "csvmerger", InformationURI: "https://github.com/nrb/csvmerger", Rules: []sarifRule{}}
+	indexes := make(map[string]int)
+	addRule := func(r Rule) {
+		if _, ok := indexes[r.ID]; !ok {
+			indexes[r.ID] = len(driver.Rules)
+			driver.Rules = append(driver.Rules, sarifRule{ID: r.ID, ShortDescription: sarifMessage{Text: r.Description}})
+		}
+	}
+	for _, r := range rules {
+		addRule(r)
+	}
+
+	results := []sarifResult{}
+	for _, d := range diags {
+		addRule(Rule{ID: d.Rule, Description: d.Rule})
+		result := sarifResult{
+			RuleID:    d.Rule,
+			RuleIndex: indexes[d.Rule],
+			Level:     d.Level,
+			Message:   sarifMessage{Text: d.Message},
+		}
+		// SARIF locations need a file, so diagnostics that aren't about
+		// one have none.
+		if d.Location.File != "" {
+			result.Locations = []sarifLocation{sarifLocationOf(d.Location)}
+		}
+		for _, r := range d.Related {
+			if r.File == "" {
+				continue
+			}
+			loc := sarifLocationOf(r)
+			id := len(result.RelatedLocations) + 1
+			loc.ID = &id
+			result.RelatedLocations = append(result.RelatedLocations, loc)
+		}
+		results = append(results, result)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}), "Error writing diagnostics")
+}
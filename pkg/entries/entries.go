@@ -1,17 +1,27 @@
 package entries
 
 import (
+	"path"
+	"sort"
+
+	"github.com/nrb/csvmerger/pkg/romaji"
 	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
 )
 
 // Find will find an equivalent entry (the needle) in a slice of entries (the haystack).
 // If the entry is found, a pointer to it is returned.
 // If the entry is not found, the pointer is nil.
 func Find(needle *types.Entry, haystack []*types.Entry) (*types.Entry, bool) {
+	return FindBy(types.ExactMatcher, needle, haystack)
+}
+
+// FindBy finds an entry matching needle according to m, like Find.
+func FindBy(m types.Matcher, needle *types.Entry, haystack []*types.Entry) (*types.Entry, bool) {
 	var found bool
 	var target *types.Entry
 	for _, e := range haystack {
-		if types.EntriesAreEqual(e, needle) {
+		if types.EntriesMatch(m, e, needle) {
 			found = true
 			target = e
 			break
@@ -29,10 +39,16 @@ func Update(target, source *types.Entry) error {
 // is not in original, it will be added. If an entry is in both,
 // the tags from both will be merged.
 func Merge(original, new []*types.Entry) []*types.Entry {
+	return MergeBy(types.ExactMatcher, original, new)
+}
+
+// MergeBy combines two slices of entries like Merge, merging entries that
+// match according to m.
+func MergeBy(m types.Matcher, original, new []*types.Entry) []*types.Entry {
 	for _, e := range new {
-		o, ok := Find(e, original)
+		o, ok := FindBy(m, e, original)
 		if ok {
-			Update(o, e)
+			o.MergeMatching(m, e)
 		} else {
 			original = append(original, e)
 		}
@@ -44,13 +60,136 @@ func Merge(original, new []*types.Entry) []*types.Entry {
 // different English terms for Japanese terms, and vice versa.
 // Any redefinitions found are returned as a slice.
 func FindRedefinition(needle *types.Entry, haystack []*types.Entry) ([]*types.Entry, bool) {
+	return FindRedefinitionBy(types.ExactMatcher, needle, haystack)
+}
+
+// FindRedefinitionBy finds the entries redefining needle like
+// FindRedefinition, comparing terms as m does.
+func FindRedefinitionBy(m types.Matcher, needle *types.Entry, haystack []*types.Entry) ([]*types.Entry, bool) {
 	redefs := []*types.Entry{}
 	var redefined bool
 	for _, e := range haystack {
-		if types.EntriesRedefined(needle, e) {
+		if types.EntriesRedefinedBy(m, needle, e) {
 			redefined = true
 			redefs = append(redefs, e)
 		}
 	}
 	return redefs, redefined
 }
+
+// FindTerm returns the entries in haystack that define term, either as
+// their Japanese text, their English text, or one of the slash-separated
+// glosses in their English text. Japanese matches when written in kana or
+// romaji as well, so machi finds まち.
+func FindTerm(term string, haystack []*types.Entry) []*types.Entry {
+	var found []*types.Entry
+	reading := romaji.Key(term)
+	for _, e := range haystack {
+		if e.Japanese == term || e.English == term || romaji.Key(e.Japanese) == reading {
+			found = append(found, e)
+			continue
+		}
+		for _, gloss := range e.Glosses() {
+			if gloss == term {
+				found = append(found, e)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// CountTags counts how many entries have each tag. Counts roll up the
+// hierarchy, so an entry tagged jlpt::n5 counts towards both jlpt::n5 and jlpt.
+func CountTags(haystack []*types.Entry) map[string]int {
+	counts := make(map[string]int)
+	for _, e := range haystack {
+		for _, tag := range e.Tags.Expand() {
+			counts[tag]++
+		}
+	}
+	return counts
+}
+
+// index maps the keys of entries, according to m, to the entries.
+func index(m types.Matcher, haystack []*types.Entry) map[string]*types.Entry {
+	idx := make(map[string]*types.Entry, len(haystack))
+	for _, e := range haystack {
+		if _, ok := idx[m.Key(e)]; !ok {
+			idx[m.Key(e)] = e
+		}
+	}
+	return idx
+}
+
+// Intersect returns the entries of a that are also in b, matching entries
+// according to m. The tags from the matching entry in b are merged into each.
+func Intersect(m types.Matcher, a, b []*types.Entry) []*types.Entry {
+	idx := index(m, b)
+	var intersection []*types.Entry
+	for _, e := range a {
+		if match, ok := idx[m.Key(e)]; ok {
+			e.MergeMatching(m, match)
+			intersection = append(intersection, e)
+		}
+	}
+	return intersection
+}
+
+// Subtract returns the entries of a that aren't in b, matching entries
+// according to m.
+func Subtract(m types.Matcher, a, b []*types.Entry) []*types.Entry {
+	idx := index(m, b)
+	var difference []*types.Entry
+	for _, e := range a {
+		if _, ok := idx[m.Key(e)]; !ok {
+			difference = append(difference, e)
+		}
+	}
+	return difference
+}
+
+// SymmetricDifference returns the entries that are in only one of a and b,
+// those from a first.
+func SymmetricDifference(m types.Matcher, a, b []*types.Entry) []*types.Entry {
+	return append(Subtract(m, a, b), Subtract(m, b, a)...)
+}
+
+// SplitByTag groups entries by their tags matching a wildcard pattern, such
+// as lesson::*. Only tags at the same level of the hierarchy as the pattern
+// are matched, including parents implied by deeper tags. An
+// entry with several matching tags is put in the group for each, or only
+// for the lowest in natural order if lowest is set. Entries without any
+// matching tags are returned separately. Groups are keyed by tag.
+func SplitByTag(haystack []*types.Entry, pattern string, lowest bool) (map[string][]*types.Entry, []*types.Entry, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, nil, errors.Wrapf(err, "Invalid pattern %s", pattern)
+	}
+
+	level := types.TagLevel(pattern)
+	groups := make(map[string][]*types.Entry)
+	var unmatched []*types.Entry
+	for _, e := range haystack {
+		var matched []string
+		for _, tag := range e.Tags.Expand() {
+			if types.TagLevel(tag) != level {
+				continue
+			}
+			if ok, _ := path.Match(pattern, tag); ok {
+				matched = append(matched, tag)
+			}
+		}
+		if len(matched) == 0 {
+			unmatched = append(unmatched, e)
+			continue
+		}
+		if lowest {
+			sort.SliceStable(matched, func(i, j int) bool { return types.NaturalLess(matched[i], matched[j]) })
+			matched = matched[:1]
+		}
+		for _, tag := range matched {
+			groups[tag] = append(groups[tag], e)
+		}
+	}
+	return groups, unmatched, nil
+}
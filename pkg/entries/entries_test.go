@@ -5,6 +5,7 @@ import (
 
 	"github.com/nrb/csvmerger/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFind(t *testing.T) {
@@ -81,6 +82,65 @@ func TestMergeLists(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+func TestMergeKeepsSources(t *testing.T) {
+	original := []*types.Entry{types.NewEntry("まち", "city / town", "1")}
+	original[0].Sources = []types.Source{{File: "lesson1.csv", Line: 1, Tags: []string{"1"}}}
+	new := []*types.Entry{types.NewEntry("まち", "city / town", "2")}
+	new[0].Sources = []types.Source{{File: "lesson2.csv", Line: 5, Tags: []string{"2"}}}
+
+	actual := Merge(original, new)
+	assert.Equal(t, []types.Source{
+		{File: "lesson1.csv", Line: 1, Tags: []string{"1"}},
+		{File: "lesson2.csv", Line: 5, Tags: []string{"2"}},
+	}, actual[0].Sources)
+}
+
+func TestFindTerm(t *testing.T) {
+	haystack := []*types.Entry{
+		types.NewEntry("まち", "city / town", "1"),
+		types.NewEntry("うち", "house / home", "2"),
+		types.NewEntry("とし", "city", "3"),
+	}
+
+	tests := []struct {
+		name     string
+		term     string
+		expected []*types.Entry
+	}{
+		{
+			name:     "Japanese term",
+			term:     "うち",
+			expected: []*types.Entry{haystack[1]},
+		},
+		{
+			name:     "Full English text",
+			term:     "city / town",
+			expected: []*types.Entry{haystack[0]},
+		},
+		{
+			name:     "Single gloss matches every entry using it",
+			term:     "city",
+			expected: []*types.Entry{haystack[0], haystack[2]},
+		},
+		{
+			name:     "Japanese matches in romaji",
+			term:     "machi",
+			expected: []*types.Entry{haystack[0]},
+		},
+		{
+			name:     "Unknown term",
+			term:     "shrine",
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, FindTerm(test.term, haystack))
+		})
+	}
+}
+
 func TestFindRedefinition(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -108,3 +168,149 @@ func TestFindRedefinition(t *testing.T) {
 		})
 	}
 }
+
+func TestCountTags(t *testing.T) {
+	haystack := []*types.Entry{
+		types.NewEntry("まち", "city / town", "jlpt::n5 lesson::01"),
+		types.NewEntry("うち", "house / home", "jlpt::n5 lesson::02"),
+		types.NewEntry("たべる", "to eat", "jlpt::n4 pos::verb::ichidan"),
+	}
+
+	expected := map[string]int{
+		"jlpt":               3,
+		"jlpt::n5":           2,
+		"jlpt::n4":           1,
+		"lesson":             2,
+		"lesson::01":         1,
+		"lesson::02":         1,
+		"pos":                1,
+		"pos::verb":          1,
+		"pos::verb::ichidan": 1,
+	}
+	assert.Equal(t, expected, CountTags(haystack))
+}
+
+func TestDeckAlgebra(t *testing.T) {
+	deck := func() ([]*types.Entry, []*types.Entry) {
+		textbook := []*types.Entry{
+			types.NewEntry("まち", "city / town", "book1"),
+			types.NewEntry("うち", "house / home", "book1"),
+			types.NewEntry("じんじゃ", "shrine", "book1"),
+		}
+		master := []*types.Entry{
+			types.NewEntry("うち", "house / home", "2"),
+			types.NewEntry("たべる", "to eat", "5"),
+			types.NewEntry("まち", "city / town", "1"),
+		}
+		return textbook, master
+	}
+
+	tests := []struct {
+		name     string
+		op       func(m types.Matcher, a, b []*types.Entry) []*types.Entry
+		expected []*types.Entry
+	}{
+		{
+			name: "Intersect keeps entries in both, with all their tags",
+			op:   Intersect,
+			expected: []*types.Entry{
+				types.NewEntry("まち", "city / town", "1 book1"),
+				types.NewEntry("うち", "house / home", "2 book1"),
+			},
+		},
+		{
+			name: "Subtract keeps entries only in the first",
+			op:   Subtract,
+			expected: []*types.Entry{
+				types.NewEntry("じんじゃ", "shrine", "book1"),
+			},
+		},
+		{
+			name: "Symmetric difference keeps entries in only one",
+			op:   SymmetricDifference,
+			expected: []*types.Entry{
+				types.NewEntry("じんじゃ", "shrine", "book1"),
+				types.NewEntry("たべる", "to eat", "5"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			textbook, master := deck()
+			assert.Equal(t, test.expected, test.op(types.ExactMatcher, textbook, master))
+		})
+	}
+}
+
+func TestMergeByKeepsTermsForRedefinitions(t *testing.T) {
+	merged := MergeBy(types.JapaneseMatcher, nil, []*types.Entry{
+		types.NewEntry("まち", "town", "1"),
+		types.NewEntry("まち", "city", "2"),
+	})
+	require.Len(t, merged, 1)
+	assert.Equal(t, "まち,city / town,1 2", merged[0].ToString())
+
+	redefs, ok := FindRedefinitionBy(types.JapaneseMatcher, types.NewEntry("むら", "town", ""), merged)
+	assert.True(t, ok)
+	assert.Equal(t, merged, redefs)
+}
+
+func TestDeckAlgebraReadingMatcher(t *testing.T) {
+	textbook := []*types.Entry{
+		types.NewEntry("machi", "city / town", "book1"),
+		types.NewEntry("jinja", "shrine", "book1"),
+	}
+	master := []*types.Entry{
+		types.NewEntry("まち", "city / town", "1"),
+		types.NewEntry("じんじゃ", "temple", "2"),
+	}
+	assert.Equal(t, []*types.Entry{types.NewEntry("machi", "city / town", "1 book1")}, Intersect(types.ReadingMatcher, textbook, master))
+	assert.Equal(t, []*types.Entry{types.NewEntry("jinja", "shrine", "book1")}, Subtract(types.ReadingMatcher, textbook, master))
+}
+
+func TestSplitByTag(t *testing.T) {
+	machi := types.NewEntry("まち", "city / town", "lesson::1 noun")
+	uchi := types.NewEntry("うち", "house / home", "lesson::10 lesson::2")
+	taberu := types.NewEntry("たべる", "to eat", "lesson::2::a verb")
+	jinja := types.NewEntry("じんじゃ", "shrine", "noun")
+	haystack := []*types.Entry{machi, uchi, taberu, jinja}
+
+	tests := []struct {
+		name              string
+		lowest            bool
+		expectedGroups    map[string][]*types.Entry
+		expectedUnmatched []*types.Entry
+	}{
+		{
+			name: "Entries go into every matching group",
+			expectedGroups: map[string][]*types.Entry{
+				"lesson::1":  {machi},
+				"lesson::2":  {uchi, taberu},
+				"lesson::10": {uchi},
+			},
+			expectedUnmatched: []*types.Entry{jinja},
+		},
+		{
+			name:   "Entries only go into their lowest group",
+			lowest: true,
+			expectedGroups: map[string][]*types.Entry{
+				"lesson::1": {machi},
+				"lesson::2": {uchi, taberu},
+			},
+			expectedUnmatched: []*types.Entry{jinja},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups, unmatched, err := SplitByTag(haystack, "lesson::*", test.lowest)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedGroups, groups)
+			assert.Equal(t, test.expectedUnmatched, unmatched)
+		})
+	}
+
+	_, _, err := SplitByTag(haystack, "lesson::[", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,195 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressedExtensions are stripped before looking at a file's format.
+var compressedExtensions = []string{".gz", ".zst"}
+
+// Open opens a file for reading. Stdin opens standard input.
+// Compressed input is recognized by its magic bytes and decompressed
+// as it is read.
+func Open(filePath string) (io.ReadCloser, error) {
+	var f *os.File
+	if filePath == Stdin {
+		f = os.Stdin
+	} else {
+		var err error
+		f, err = os.Open(filePath)
+		if err != nil {
+			return nil, errors.Wrap(err, "Couldn't open file")
+		}
+	}
+
+	r, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// decompress wraps rc in a decompressing reader if its contents start
+// with a known magic number. Plain input is returned as is.
+func decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "Couldn't read file")
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrap(err, "Couldn't read gzip data")
+		}
+		return &readCloser{Reader: gz, closers: []io.Closer{gz, rc}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		// Files are already read concurrently, so each is decoded on a
+		// single goroutine.
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, errors.Wrap(err, "Couldn't read zstd data")
+		}
+		zrc := zr.IOReadCloser()
+		return &readCloser{Reader: zrc, closers: []io.Closer{zrc, rc}}, nil
+	}
+	return &readCloser{Reader: br, closers: []io.Closer{rc}}, nil
+}
+
+// Create opens a file for writing. Stdin or an empty path writes to
+// standard output. Output is gzip compressed if the path ends in .gz, and
+// zstd compressed if it ends in .zst.
+func Create(filePath string) (io.WriteCloser, error) {
+	if filePath == "" || filePath == Stdin {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't create file")
+	}
+	return compress(f, filePath)
+}
+
+// compress returns a writer compressing to f as its path asks for, which
+// closes f when closed.
+func compress(f *os.File, filePath string) (io.WriteCloser, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".gz":
+		gz := gzip.NewWriter(f)
+		return &writeCloser{Writer: gz, closers: []io.Closer{gz, f}}, nil
+	case ".zst":
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "Couldn't write zstd data")
+		}
+		return &writeCloser{Writer: zw, closers: []io.Closer{zw, f}}, nil
+	}
+	return f, nil
+}
+
+// Replace rewrites an existing file with what write writes, compressed
+// like Create would. It's written to a temporary file in the same directory
+// which then replaces the original, so a failed write leaves the original
+// as it was.
+func Replace(filePath string, write func(io.Writer) error) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return errors.Wrap(err, "Couldn't replace file")
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "Couldn't create file")
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(info.Mode().Perm()); err != nil {
+		f.Close()
+		return errors.Wrap(err, "Couldn't create file")
+	}
+	w, err := compress(f, filePath)
+	if err != nil {
+		return err
+	}
+	if err := write(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "Error writing file")
+	}
+	return errors.Wrap(os.Rename(f.Name(), filePath), "Couldn't replace file")
+}
+
+// CompressedExt returns the compression extension of a path, like .gz for
+// deck.csv.gz, or the empty string if it isn't compressed.
+func CompressedExt(filePath string) string {
+	ext := filepath.Ext(filePath)
+	for _, e := range compressedExtensions {
+		if strings.EqualFold(ext, e) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// trimCompressedExt removes a compression extension from a path, so
+// deck.tsv.gz is treated like deck.tsv.
+func trimCompressedExt(filePath string) string {
+	return strings.TrimSuffix(filePath, CompressedExt(filePath))
+}
+
+// readCloser closes all of its closers, in order.
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	return closeAll(r.closers)
+}
+
+// writeCloser closes all of its closers, in order, so that compressed
+// data is flushed before the underlying file is closed.
+type writeCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *writeCloser) Close() error {
+	return closeAll(w.closers)
+}
+
+func closeAll(closers []io.Closer) error {
+	var first error
+	for _, c := range closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,141 @@
+package file
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAndOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvmerger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	entries := []*types.Entry{
+		types.NewEntry("まち", "city / town", "1 2 3"),
+		types.NewEntry("うち", "house / home", "2 3"),
+	}
+
+	tests := []struct {
+		name          string
+		fileName      string
+		expectedMagic []byte
+	}{
+		{
+			name:     "Plain output is not compressed",
+			fileName: "deck.csv",
+		},
+		{
+			name:          "Output ending in .gz is gzip compressed",
+			fileName:      "deck.csv.gz",
+			expectedMagic: gzipMagic,
+		},
+		{
+			name:          "Compressed TSV output keeps tabs",
+			fileName:      "deck.tsv.gz",
+			expectedMagic: gzipMagic,
+		},
+		{
+			name:          "Output ending in .zst is zstd compressed",
+			fileName:      "deck.csv.zst",
+			expectedMagic: zstdMagic,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.fileName)
+			w, err := Create(path)
+			require.NoError(t, err)
+			require.NoError(t, WriteEntries(w, entries, Separator(path)))
+			require.NoError(t, w.Close())
+
+			raw, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			if test.expectedMagic != nil {
+				assert.Equal(t, test.expectedMagic, raw[:len(test.expectedMagic)])
+			}
+
+			actual, err := CSVToEntries(path)
+			require.NoError(t, err)
+			for _, e := range actual {
+				e.Sources = nil
+			}
+			assert.Equal(t, entries, actual)
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvmerger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "deck.csv.gz")
+	entries := []*types.Entry{types.NewEntry("まち", "city / town", "1")}
+	w, err := Create(path)
+	require.NoError(t, err)
+	require.NoError(t, WriteEntries(w, entries, ","))
+	require.NoError(t, w.Close())
+	require.NoError(t, os.Chmod(path, 0600))
+
+	// A failed write leaves the file as it was.
+	err = Replace(path, func(w io.Writer) error {
+		io.WriteString(w, "たべる,to eat,")
+		return errors.New("Failed")
+	})
+	assert.Error(t, err)
+	actual, err := CSVToEntries(path)
+	require.NoError(t, err)
+	require.Len(t, actual, 1)
+	assert.Equal(t, "まち", actual[0].Japanese)
+
+	entries = append(entries, types.NewEntry("たべる", "to eat", "2"))
+	require.NoError(t, Replace(path, func(w io.Writer) error {
+		return WriteEntries(w, entries, ",")
+	}))
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, gzipMagic, raw[:len(gzipMagic)])
+	actual, err = CSVToEntries(path)
+	require.NoError(t, err)
+	for _, e := range actual {
+		e.Sources = nil
+	}
+	assert.Equal(t, entries, actual)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	assert.Error(t, Replace(filepath.Join(dir, "missing.csv"), func(io.Writer) error { return nil }))
+}
+
+func TestOpenCorruptZstdReturnsError(t *testing.T) {
+	f, err := ioutil.TempFile("", "csvmerger")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(append(zstdMagic, 0, 0, 0))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = CSVToEntries(f.Name())
+	assert.Error(t, err)
+}
+
+func TestCompressedExt(t *testing.T) {
+	assert.Equal(t, ".gz", CompressedExt("my.deck.csv.gz"))
+	assert.Equal(t, ".ZST", CompressedExt("deck.tsv.ZST"))
+	assert.Equal(t, "", CompressedExt("my.deck.csv"))
+}
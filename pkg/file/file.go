@@ -1,71 +1,199 @@
 package file
 
 import (
-	"bufio"
-	"os"
+	"fmt"
+	"io"
+	"path/filepath"
 	"strings"
 
 	"github.com/nrb/csvmerger/pkg/types"
 	"github.com/pkg/errors"
 )
 
+// Stdin is the file path that stands for standard input.
+const Stdin = "-"
+
+// Separator returns the field separator used by a file, based on its extension.
+// .tsv files are tab-separated, everything else is comma-separated.
+// Compression extensions such as .gz are ignored.
+func Separator(filePath string) string {
+	if strings.EqualFold(filepath.Ext(trimCompressedExt(filePath)), ".tsv") {
+		return "\t"
+	}
+	return ","
+}
+
+// LineToEntry parses a comma-separated line into an Entry.
 func LineToEntry(line string) (*types.Entry, error) {
-	fields := strings.Split(line, ",")
-	switch {
-	case len(fields) > 3:
-		// We have an extra comma, check for surrounding quotes
-		var start, end int
-		for i, f := range fields {
-			if strings.HasPrefix(f, `"`) {
-				start = i
-			}
-			if strings.HasSuffix(f, `"`) {
-				end = i
-			}
-		}
-		// Try to merge the quoted text into one field
-		var newField string
-		if start < end {
-			newField = strings.Join(fields[start:end+1], ",")
+	return SeparatedLineToEntry(line, ",")
+}
+
+// SeparatedLineToEntry parses a line whose fields are split by sep into an Entry.
+// Fields containing the separator may be surrounded by double quotes.
+func SeparatedLineToEntry(line, sep string) (*types.Entry, error) {
+	fields, err := splitFields(line, sep, 3)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewEntry(fields[0], fields[1], fields[2]), nil
+}
+
+// SeparatedLineWithSourcesToEntry parses a line like SeparatedLineToEntry,
+// with an optional fourth field holding the entry's sources, as written by
+// types.FormatSources.
+func SeparatedLineWithSourcesToEntry(line, sep string) (*types.Entry, error) {
+	fields, err := splitFields(line, sep, 4)
+	if err != nil {
+		return nil, err
+	}
+	return fieldsToEntry(fields, line)
+}
+
+// separatedLineWithVariantsToEntry parses a line like
+// SeparatedLineWithSourcesToEntry, with an optional fifth field holding the
+// entry's variants, as written by types.FormatVariants.
+func separatedLineWithVariantsToEntry(line, sep string) (*types.Entry, error) {
+	fields, err := splitFields(line, sep, 5)
+	if err != nil {
+		return nil, err
+	}
+	return fieldsToEntry(fields, line)
+}
+
+// fieldsToEntry makes an Entry from the fields of a line, along with its
+// sources and variants if the line has fields for them.
+func fieldsToEntry(fields []string, line string) (*types.Entry, error) {
+	e := types.NewEntry(fields[0], fields[1], fields[2])
+	if len(fields) > 3 {
+		sources, err := types.ParseSources(fields[3])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid sources field for %s", line)
 		}
-		// Insert the actual field into the fields, and drop any extras
-		if newField != "" {
-			fields[start] = newField
-			fields = append(fields[:end], fields[end+1:]...)
+		e.Sources = sources
+	}
+	if len(fields) > 4 {
+		variants, err := types.ParseVariants(fields[4])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid variants field for %s", line)
 		}
-		// Our attempt at fixing the problem didn't work, error
-		if len(fields) != 3 {
-			return nil, errors.Errorf("Expected 3 fields, got %d for %s", len(fields), line)
+		e.Variants = variants
+	}
+	return e, nil
+}
+
+// splitFields splits a line into between 3 and max fields.
+func splitFields(line, sep string, max int) ([]string, error) {
+	expected := "3"
+	if max > 3 {
+		expected = fmt.Sprintf("3 or %d", max)
+	}
+	fields := joinQuoted(strings.Split(line, sep), sep)
+	if len(fields) < 3 || len(fields) > max {
+		return nil, errors.Errorf("Expected %s fields, got %d for %s", expected, len(fields), line)
+	}
+	return fields, nil
+}
+
+// joinQuoted joins fields that were split inside double quotes back into
+// one field. The quotes are kept as part of the field.
+func joinQuoted(fields []string, sep string) []string {
+	joined := fields[:0]
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if opensQuote(f) {
+			// Merge up to the field closing the quotes, if there is one
+			for j := i + 1; j < len(fields); j++ {
+				if strings.HasSuffix(fields[j], `"`) {
+					f = strings.Join(fields[i:j+1], sep)
+					i = j
+					break
+				}
+			}
 		}
-	case len(fields) < 3:
-		return nil, errors.Errorf("Expected 3 fields, got %d for %s", len(fields), line)
+		joined = append(joined, f)
 	}
-	return types.NewEntry(fields[0], fields[1], fields[2]), nil
+	return joined
+}
+
+// opensQuote reports whether a field starts double quotes that it doesn't
+// close, going by whether it has an odd number of them.
+func opensQuote(f string) bool {
+	return strings.HasPrefix(f, `"`) && strings.Count(f, `"`)%2 == 1
 }
 
+// quoteField surrounds a field with double quotes if it holds sep and
+// wouldn't be read back as one field otherwise. Fields already in quotes,
+// as read from a file, are left as they are.
+func quoteField(f, sep string) string {
+	if fields := joinQuoted(strings.Split(f, sep), sep); len(fields) > 1 {
+		return `"` + f + `"`
+	}
+	return f
+}
+
+// CSVToEntries loads all entries from a file. The path Stdin reads from
+// standard input, and compressed files are decompressed while reading.
 func CSVToEntries(filePath string) ([]*types.Entry, error) {
-	var entries []*types.Entry
-	f, err := os.Open(filePath)
+	return loadEntries(filePath, Options{})
+}
+
+// loadEntries loads all entries from a file like CSVToEntries, reading them
+// as opts say.
+func loadEntries(filePath string, opts Options) ([]*types.Entry, error) {
+	f, err := Open(filePath)
 	if err != nil {
-		return nil, errors.Wrap(err, "Couldn't open file")
+		return nil, err
 	}
 	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		// Don't process empty lines
-		t := scanner.Text()
-		if t == "" {
-			continue
+	return readEntries(opts.NewReader(f, filePath))
+}
+
+// SourceName returns the name entries loaded from a file record as their source.
+func SourceName(filePath string) string {
+	if filePath == Stdin {
+		return "stdin"
+	}
+	return filePath
+}
+
+// ReadEntries loads all entries from r, one per line, with fields split by sep.
+// Entries record name as their source file.
+func ReadEntries(r io.Reader, sep, name string) ([]*types.Entry, error) {
+	return readEntries(NewReader(r, sep, name))
+}
+
+func readEntries(reader *Reader) ([]*types.Entry, error) {
+	var entries []*types.Entry
+	for {
+		e, err := reader.Next()
+		if err == io.EOF {
+			return entries, nil
 		}
-		e, err := LineToEntry(t)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, err
 		}
 		entries = append(entries, e)
-
 	}
-	if err = scanner.Err(); err != nil {
-		return nil, errors.Wrap(err, "Error reading file")
+}
+
+// WriteEntries writes entries to w, one per line, with fields joined by sep.
+func WriteEntries(w io.Writer, entries []*types.Entry, sep string) error {
+	return writeEntries(NewWriter(w, sep), entries)
+}
+
+// WriteEntriesWithSources writes entries like WriteEntries, with an extra
+// field holding each entry's sources.
+func WriteEntriesWithSources(w io.Writer, entries []*types.Entry, sep string) error {
+	writer := NewWriter(w, sep)
+	writer.Sources = true
+	return writeEntries(writer, entries)
+}
+
+func writeEntries(writer *Writer, entries []*types.Entry) error {
+	for _, e := range entries {
+		if err := writer.Write(e); err != nil {
+			return err
+		}
 	}
-	return entries, nil
+	return writer.Flush()
 }
@@ -2,10 +2,14 @@ package file
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/nrb/csvmerger/pkg/romaji"
+	"github.com/nrb/csvmerger/pkg/tagrules"
 	"github.com/nrb/csvmerger/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLineToEntry(t *testing.T) {
@@ -35,6 +39,11 @@ func TestLineToEntry(t *testing.T) {
 			line:          `はい、どうぞ,"yes, please",13`,
 			expectedEntry: types.NewEntry("はい、どうぞ", `"yes, please"`, "13"),
 		},
+		{
+			name:        "Fourth field is an error",
+			line:        "まち,city / town,1 2,a.csv:3=1",
+			expectedErr: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -48,6 +57,56 @@ func TestLineToEntry(t *testing.T) {
 	}
 }
 
+func TestSeparatedLineWithSourcesToEntry(t *testing.T) {
+	tests := []struct {
+		name          string
+		line          string
+		expectedEntry *types.Entry
+		expectedErr   bool
+	}{
+		{
+			name:          "Sources field may be left out",
+			line:          "まち,city / town,1 2",
+			expectedEntry: types.NewEntry("まち", "city / town", "1 2"),
+		},
+		{
+			name: "Fourth field holds sources",
+			line: "まち,city / town,1 2,a.csv:3=1;b.csv:10=2",
+			expectedEntry: withSources(types.NewEntry("まち", "city / town", "1 2"),
+				types.Source{File: "a.csv", Line: 3, Tags: []string{"1"}},
+				types.Source{File: "b.csv", Line: 10, Tags: []string{"2"}},
+			),
+		},
+		{
+			name: "Quoted field and sources",
+			line: `はい、どうぞ,"yes, please",13,a.csv:1`,
+			expectedEntry: withSources(types.NewEntry("はい、どうぞ", `"yes, please"`, "13"),
+				types.Source{File: "a.csv", Line: 1},
+			),
+		},
+		{
+			name:        "Fourth field that isn't sources is an error",
+			line:        "まち,city / town,1 2,extra",
+			expectedErr: true,
+		},
+		{
+			name:        "Fifth field is an error",
+			line:        "まち,city / town,1 2,a.csv:3,extra",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := SeparatedLineWithSourcesToEntry(test.line, ",")
+			assert.Equal(t, test.expectedErr, err != nil)
+			if test.expectedEntry != nil {
+				assert.Equal(t, test.expectedEntry, actual)
+			}
+		})
+	}
+}
+
 func TestCSVToEntries(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -59,8 +118,38 @@ func TestCSVToEntries(t *testing.T) {
 			name:     "Short valid file",
 			fileName: "validfile.csv",
 			expectedEntries: []*types.Entry{
-				types.NewEntry("まち", "city / town", "1 2 3"),
-				types.NewEntry("うち", "house / home", "2 3"),
+				withSources(types.NewEntry("まち", "city / town", "1 2 3"),
+					types.Source{File: "testdata/validfile.csv", Line: 1, Tags: []string{"1", "2", "3"}}),
+				withSources(types.NewEntry("うち", "house / home", "2 3"),
+					types.Source{File: "testdata/validfile.csv", Line: 2, Tags: []string{"2", "3"}}),
+			},
+		},
+		{
+			name:     "Gzip compressed file is decompressed",
+			fileName: "validfile.csv.gz",
+			expectedEntries: []*types.Entry{
+				withSources(types.NewEntry("まち", "city / town", "1 2 3"),
+					types.Source{File: "testdata/validfile.csv.gz", Line: 1, Tags: []string{"1", "2", "3"}}),
+				withSources(types.NewEntry("うち", "house / home", "2 3"),
+					types.Source{File: "testdata/validfile.csv.gz", Line: 2, Tags: []string{"2", "3"}}),
+			},
+		},
+		{
+			name:     "Zstd compressed file is decompressed",
+			fileName: "validfile.csv.zst",
+			expectedEntries: []*types.Entry{
+				withSources(types.NewEntry("まち", "city / town", "1 2 3"),
+					types.Source{File: "testdata/validfile.csv.zst", Line: 1, Tags: []string{"1", "2", "3"}}),
+				withSources(types.NewEntry("うち", "house / home", "2 3"),
+					types.Source{File: "testdata/validfile.csv.zst", Line: 2, Tags: []string{"2", "3"}}),
+			},
+		},
+		{
+			name:     "TSV files are split on tabs",
+			fileName: filepath.Join("lessons", "02", "03.tsv"),
+			expectedEntries: []*types.Entry{
+				withSources(types.NewEntry("うち", "house / home", "2"),
+					types.Source{File: "testdata/lessons/02/03.tsv", Line: 1, Tags: []string{"2"}}),
 			},
 		},
 		{
@@ -82,3 +171,194 @@ func TestCSVToEntries(t *testing.T) {
 		})
 	}
 }
+
+func withSources(e *types.Entry, sources ...types.Source) *types.Entry {
+	e.Sources = sources
+	return e
+}
+
+func TestWriteEntries(t *testing.T) {
+	entries := []*types.Entry{
+		types.NewEntry("まち", "city / town", "3 1"),
+		types.NewEntry("うち", "house / home", ""),
+	}
+
+	var b strings.Builder
+	err := WriteEntries(&b, entries, "\t")
+	require.NoError(t, err)
+	assert.Equal(t, "まち\tcity / town\t1 3\nうち\thouse / home\t\n", b.String())
+}
+
+func TestWriterFlattensTags(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b, ",")
+	w.FlatTagSeparator = "_"
+	require.NoError(t, w.Write(types.NewEntry("まち", "city / town", "jlpt::n5 lesson::01")))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "まち,city / town,jlpt_n5 lesson_01\n", b.String())
+}
+
+func TestWriterTagOrder(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b, ",")
+	w.TagOrder = types.LexicalOrder
+	require.NoError(t, w.Write(types.NewEntry("まち", "city / town", "2 10")))
+	w.TagOrder = types.NaturalOrder
+	require.NoError(t, w.Write(types.NewEntry("まち", "city / town", "2 10")))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "まち,city / town,10 2\nまち,city / town,2 10\n", b.String())
+}
+
+func TestWriteEntriesWithSources(t *testing.T) {
+	entries := []*types.Entry{
+		withSources(types.NewEntry("まち", "city / town", "1 3"),
+			types.Source{File: "a.csv", Line: 1, Tags: []string{"1"}},
+			types.Source{File: "b;c.csv", Line: 4, Tags: []string{"3"}}),
+	}
+
+	var b strings.Builder
+	err := WriteEntriesWithSources(&b, entries, ",")
+	require.NoError(t, err)
+	assert.Equal(t, "まち,city / town,1 3,a.csv:1=1;b%3Bc.csv:4=3\n", b.String())
+
+	opts := Options{Sources: true}
+	actual, err := readEntries(opts.NewReader(strings.NewReader(b.String()), "deck.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, entries, actual)
+
+	_, err = ReadEntries(strings.NewReader(b.String()), ",", "deck.csv")
+	assert.Error(t, err)
+}
+
+func TestWriterCombinesVariants(t *testing.T) {
+	e := types.NewEntry("まち", "town", "1")
+	e.Variants = []types.Variant{{Japanese: "まち", English: "city"}}
+
+	var b strings.Builder
+	w := NewWriter(&b, ",")
+	require.NoError(t, w.Write(e))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "まち,city / town,1\n", b.String())
+
+	// Variants can be written apart, to be read back.
+	b.Reset()
+	w = NewWriter(&b, ",")
+	w.Sources = true
+	w.Variants = true
+	require.NoError(t, w.Write(e))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "まち,town,1,,まち=city\n", b.String())
+
+	r := NewReader(strings.NewReader(b.String()), ",", "")
+	r.Sources = true
+	r.Variants = true
+	actual, err := readEntries(r)
+	require.NoError(t, err)
+	assert.Equal(t, []*types.Entry{e}, actual)
+}
+
+func TestWriterQuotesSeparators(t *testing.T) {
+	tests := []struct {
+		name     string
+		tsv      string
+		expected string
+		// read is the entry the CSV is read back as.
+		read *types.Entry
+	}{
+		{
+			name:     "Field with a comma is quoted",
+			tsv:      "いえ\thouse, home\t2",
+			expected: "いえ,\"house, home\",2\n",
+			read:     types.NewEntry("いえ", `"house, home"`, "2"),
+		},
+		{
+			name:     "Several fields with commas",
+			tsv:      "はい、どうぞ,よ\tyes,please\t1",
+			expected: "\"はい、どうぞ,よ\",\"yes,please\",1\n",
+			read:     types.NewEntry(`"はい、どうぞ,よ"`, `"yes,please"`, "1"),
+		},
+		{
+			name:     "Quoted field isn't quoted again",
+			tsv:      "はい、どうぞ\t\"yes, please\"\t13",
+			expected: "はい、どうぞ,\"yes, please\",13\n",
+			read:     types.NewEntry("はい、どうぞ", `"yes, please"`, "13"),
+		},
+		{
+			name:     "Field with quotes and a comma",
+			tsv:      "まち\t\"big\" city, town\t1",
+			expected: "まち,\"\"big\" city, town\",1\n",
+			read:     types.NewEntry("まち", `""big" city, town"`, "1"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := ReadEntries(strings.NewReader(test.tsv), "\t", "")
+			require.NoError(t, err)
+
+			var b strings.Builder
+			require.NoError(t, WriteEntries(&b, entries, ","))
+			assert.Equal(t, test.expected, b.String())
+
+			// Quotes are kept when the CSV is read back, as for any CSV.
+			actual, err := ReadEntries(strings.NewReader(b.String()), ",", "")
+			require.NoError(t, err)
+			assert.Equal(t, []*types.Entry{test.read}, actual)
+
+			// Writing it again doesn't change it.
+			var again strings.Builder
+			require.NoError(t, WriteEntries(&again, actual, ","))
+			assert.Equal(t, b.String(), again.String())
+		})
+	}
+}
+
+func TestReaderContinuesAfterParseError(t *testing.T) {
+	r := NewReader(strings.NewReader("まち,city / town\n\nたべる,to eat,1"), ",", "deck.csv")
+	_, err := r.Next()
+	perr, ok := err.(*ParseError)
+	require.True(t, ok)
+	assert.Equal(t, 1, perr.Line)
+	assert.Equal(t, "deck.csv:1: Expected 3 fields, got 2 for まち,city / town", perr.Error())
+
+	e, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "たべる", e.Japanese)
+	assert.Equal(t, 3, r.Line())
+}
+
+func TestReaderRewritesTagsOnce(t *testing.T) {
+	rules, err := tagrules.Parse(strings.NewReader("rename a a::b"))
+	require.NoError(t, err)
+	r := NewReader(strings.NewReader("いぬ,dog,x\nいぬ,dog,a\n"), ",", "")
+	r.Tags = TagEdit{Add: []string{"a"}}
+	r.Rules = rules
+	entries, err := readEntries(r)
+	require.NoError(t, err)
+	assert.Equal(t, "a::b x", entries[0].Tags.ToString())
+
+	// Merging doesn't rewrite the tags again.
+	require.NoError(t, entries[0].MergeTags(entries[1]))
+	assert.Equal(t, "a::b x", entries[0].Tags.ToString())
+}
+
+func TestWriterAddsRomaji(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b, ",")
+	w.Romaji = romaji.Kunrei
+	require.NoError(t, w.Write(types.NewEntry("まち", "city / town", "1")))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "まち,city / town,1,mati\n", b.String())
+}
+
+func TestReaderConvertsRomaji(t *testing.T) {
+	r := NewReader(strings.NewReader("machi,city / town,1\nTシャツ,T-shirt,2\ncity,まち,3\n"), ",", "")
+	r.Romaji = true
+	entries, err := readEntries(r)
+	require.NoError(t, err)
+	assert.Equal(t, []*types.Entry{
+		types.NewEntry("まち", "city / town", "1"),
+		types.NewEntry("Tシャツ", "T-shirt", "2"),
+		types.NewEntry("city", "まち", "3"),
+	}, entries)
+}
@@ -0,0 +1,219 @@
+package file
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// TagEdit adds and removes tags on every entry loaded from a file, such as
+// a source tag for a textbook chapter.
+type TagEdit struct {
+	Add    []string
+	Remove []string
+}
+
+// ParseTagEdit parses a comma-separated list of tags to add, prefixed by +,
+// and tags to remove, prefixed by -, like +book2,+ch5,-draft.
+func ParseTagEdit(s string) (TagEdit, error) {
+	var edit TagEdit
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) < 2 {
+			return TagEdit{}, errors.Errorf("Expected +TAG or -TAG, got %q", field)
+		}
+		tag := field[1:]
+		if strings.ContainsAny(tag, " \t") {
+			return TagEdit{}, errors.Errorf("Tags can't contain spaces, got %q", tag)
+		}
+		switch field[0] {
+		case '+':
+			edit.Add = append(edit.Add, tag)
+		case '-':
+			edit.Remove = append(edit.Remove, tag)
+		default:
+			return TagEdit{}, errors.Errorf("Expected +TAG or -TAG, got %q", field)
+		}
+	}
+	return edit, nil
+}
+
+// IsZero reports whether the TagEdit doesn't change any tags.
+func (t TagEdit) IsZero() bool {
+	return len(t.Add) == 0 && len(t.Remove) == 0
+}
+
+// Then returns a TagEdit making the changes of t, then those of next, so
+// next wins when both add and remove the same tag.
+func (t TagEdit) Then(next TagEdit) TagEdit {
+	var combined TagEdit
+	for _, tag := range t.Add {
+		if !removes(next.Remove, tag) {
+			combined.Add = append(combined.Add, tag)
+		}
+	}
+	combined.Add = append(combined.Add, next.Add...)
+	combined.Remove = append(append(combined.Remove, t.Remove...), next.Remove...)
+	return combined
+}
+
+// Apply removes tags from an entry, along with the tags below them, then
+// adds tags to it.
+func (t TagEdit) Apply(e *types.Entry) {
+	for tag := range e.Tags.Tags {
+		if removes(t.Remove, tag) {
+			delete(e.Tags.Tags, tag)
+		}
+	}
+	for _, tag := range t.Add {
+		e.Tags.Insert(tag)
+	}
+}
+
+// removes reports whether removing tags would remove tag.
+func removes(tags []string, tag string) bool {
+	for _, r := range tags {
+		if tag == r || types.IsTagDescendant(tag, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// FileTagEdit is a TagEdit for the files matching a pattern.
+type FileTagEdit struct {
+	// Pattern is a file path, a glob like those accepted by ExpandPaths,
+	// or a glob without directories matched against file names.
+	Pattern string
+	Edit    TagEdit
+}
+
+// Matches reports whether the pattern matches a file path.
+func (f FileTagEdit) Matches(path string) bool {
+	if f.Pattern == path {
+		return true
+	}
+	if path == Stdin {
+		return false
+	}
+	if !strings.ContainsAny(f.Pattern, `/\`) {
+		ok, _ := filepath.Match(f.Pattern, filepath.Base(path))
+		return ok
+	}
+	ok, _ := matchParts(splitPath(f.Pattern), splitPath(path))
+	return ok
+}
+
+// TagEdits are the tag edits for input files.
+type TagEdits []FileTagEdit
+
+// For returns the TagEdit for a file, combining every matching edit in order.
+func (edits TagEdits) For(path string) TagEdit {
+	var edit TagEdit
+	for _, f := range edits {
+		if f.Matches(path) {
+			edit = edit.Then(f.Edit)
+		}
+	}
+	return edit
+}
+
+// LoadTagEdits loads tag edits from a file. See ParseTagEdits for the format.
+func LoadTagEdits(path string) (TagEdits, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't open tag file")
+	}
+	defer f.Close()
+	return ParseTagEdits(f)
+}
+
+// ParseTagEdits parses tag edits, one file pattern per line followed by the
+// tags to add and remove for matching files:
+//
+//	textbook/ch5.csv  +book2 +ch5
+//	drafts/*.csv      -reviewed
+//
+// Anything after a # is a comment.
+func ParseTagEdits(r io.Reader) (TagEdits, error) {
+	var edits TagEdits
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, errors.Errorf("Line %d: expected a file pattern and tags", line)
+		}
+		edit, err := ParseTagEdit(strings.Join(fields[1:], ","))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Line %d", line)
+		}
+		edits = append(edits, FileTagEdit{Pattern: fields[0], Edit: edit})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Error reading tag file")
+	}
+	return edits, nil
+}
+
+// SplitTagEdit splits an argument like chapter5.csv:+book2,+ch5 into the
+// path and the TagEdit for it. Arguments naming existing files, or without
+// a : followed by + or -, are returned as they are.
+func SplitTagEdit(arg string) (string, TagEdit, error) {
+	if _, err := os.Stat(arg); err == nil {
+		return arg, TagEdit{}, nil
+	}
+	for i := 0; i+1 < len(arg); i++ {
+		if arg[i] == ':' && (arg[i+1] == '+' || arg[i+1] == '-') {
+			edit, err := ParseTagEdit(arg[i+1:])
+			if err != nil {
+				return "", TagEdit{}, errors.Wrapf(err, "Bad tags for %s", arg[:i])
+			}
+			return arg[:i], edit, nil
+		}
+	}
+	return arg, TagEdit{}, nil
+}
+
+// ExpandInputs expands arguments like ExpandPaths, after splitting off any
+// tags to add and remove, as in chapter5.csv:+book2,+ch5. The edits returned
+// apply to every file an argument expands to.
+func ExpandInputs(args []string) ([]string, TagEdits, error) {
+	var paths []string
+	var edits TagEdits
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		path, edit, err := SplitTagEdit(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		expanded, err := ExpandPaths([]string{path})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range expanded {
+			if !edit.IsZero() {
+				edits = append(edits, FileTagEdit{Pattern: p, Edit: edit})
+			}
+			if p != Stdin && seen[p] {
+				continue
+			}
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return paths, edits, nil
+}
@@ -0,0 +1,182 @@
+package file
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTagEdit(t *testing.T) {
+	tests := []struct {
+		name         string
+		edit         string
+		expectedEdit TagEdit
+		expectedErr  bool
+	}{
+		{
+			name:         "Tags to add and remove are parsed",
+			edit:         "+book2,+ch5,-draft",
+			expectedEdit: TagEdit{Add: []string{"book2", "ch5"}, Remove: []string{"draft"}},
+		},
+		{
+			name:         "Hierarchical tags work",
+			edit:         "+source::book2",
+			expectedEdit: TagEdit{Add: []string{"source::book2"}},
+		},
+		{
+			name:        "Tags need a + or -",
+			edit:        "+book2,ch5",
+			expectedErr: true,
+		},
+		{
+			name:        "Empty tags return an error",
+			edit:        "+book2,+",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			edit, err := ParseTagEdit(test.edit)
+			assert.Equal(t, test.expectedErr, err != nil)
+			if !test.expectedErr {
+				assert.Equal(t, test.expectedEdit, edit)
+			}
+		})
+	}
+}
+
+func TestTagEditApply(t *testing.T) {
+	e := types.NewEntry("まち", "city / town", "1 draft draft::old noun")
+	TagEdit{Add: []string{"book2", "ch5"}, Remove: []string{"draft", "missing"}}.Apply(e)
+	assert.Equal(t, "1 book2 ch5 noun", e.Tags.ToString())
+}
+
+func TestTagEditsFor(t *testing.T) {
+	edits := TagEdits{
+		{Pattern: "*.csv", Edit: TagEdit{Add: []string{"imported"}}},
+		{Pattern: "textbook/**/*.csv", Edit: TagEdit{Add: []string{"book2"}, Remove: []string{"draft"}}},
+		{Pattern: filepath.Join("textbook", "ch5.csv"), Edit: TagEdit{Add: []string{"ch5", "draft"}, Remove: []string{"imported"}}},
+	}
+	tests := []struct {
+		name         string
+		path         string
+		expectedEdit TagEdit
+	}{
+		{
+			name:         "Patterns without directories match file names",
+			path:         filepath.Join("other", "deck.csv"),
+			expectedEdit: TagEdit{Add: []string{"imported"}},
+		},
+		{
+			name: "Later edits win",
+			path: filepath.Join("textbook", "ch5.csv"),
+			expectedEdit: TagEdit{
+				Add:    []string{"book2", "ch5", "draft"},
+				Remove: []string{"draft", "imported"},
+			},
+		},
+		{
+			name:         "Stdin only matches itself",
+			path:         Stdin,
+			expectedEdit: TagEdit{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectedEdit, edits.For(test.path))
+		})
+	}
+}
+
+func TestParseTagEdits(t *testing.T) {
+	edits, err := ParseTagEdits(strings.NewReader(`
+# Textbook chapters
+textbook/ch5.csv  +book2 +ch5   # new chapter
+drafts/*.csv      -reviewed
+`))
+	require.NoError(t, err)
+	assert.Equal(t, TagEdits{
+		{Pattern: "textbook/ch5.csv", Edit: TagEdit{Add: []string{"book2", "ch5"}}},
+		{Pattern: "drafts/*.csv", Edit: TagEdit{Remove: []string{"reviewed"}}},
+	}, edits)
+
+	_, err = ParseTagEdits(strings.NewReader("textbook/ch5.csv"))
+	assert.Error(t, err)
+	_, err = ParseTagEdits(strings.NewReader("textbook/ch5.csv book2"))
+	assert.Error(t, err)
+}
+
+func TestExpandInputs(t *testing.T) {
+	lessons := filepath.Join("testdata", "lessons")
+	tests := []struct {
+		name          string
+		args          []string
+		expectedPaths []string
+		expectedEdits TagEdits
+		expectedErr   bool
+	}{
+		{
+			name:          "Arguments without tags have no edits",
+			args:          []string{filepath.Join(lessons, "01.csv")},
+			expectedPaths: []string{filepath.Join(lessons, "01.csv")},
+		},
+		{
+			name:          "Tags are split off files",
+			args:          []string{filepath.Join(lessons, "01.csv") + ":+book2,+jlpt::n5,-1"},
+			expectedPaths: []string{filepath.Join(lessons, "01.csv")},
+			expectedEdits: TagEdits{
+				{Pattern: filepath.Join(lessons, "01.csv"), Edit: TagEdit{Add: []string{"book2", "jlpt::n5"}, Remove: []string{"1"}}},
+			},
+		},
+		{
+			name: "Tags apply to every file in a directory",
+			args: []string{lessons + ":+book2"},
+			expectedPaths: []string{
+				filepath.Join(lessons, "01.csv"),
+				filepath.Join(lessons, "02", "03.tsv"),
+			},
+			expectedEdits: TagEdits{
+				{Pattern: filepath.Join(lessons, "01.csv"), Edit: TagEdit{Add: []string{"book2"}}},
+				{Pattern: filepath.Join(lessons, "02", "03.tsv"), Edit: TagEdit{Add: []string{"book2"}}},
+			},
+		},
+		{
+			name:          "Stdin can have tags",
+			args:          []string{"-:+typed"},
+			expectedPaths: []string{"-"},
+			expectedEdits: TagEdits{{Pattern: "-", Edit: TagEdit{Add: []string{"typed"}}}},
+		},
+		{
+			name:        "Bad tags return an error",
+			args:        []string{filepath.Join(lessons, "01.csv") + ":+book2,ch5"},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paths, edits, err := ExpandInputs(test.args)
+			assert.Equal(t, test.expectedErr, err != nil)
+			if !test.expectedErr {
+				assert.Equal(t, test.expectedPaths, paths)
+				assert.Equal(t, test.expectedEdits, edits)
+			}
+		})
+	}
+}
+
+func TestLoadAllAppliesTagEdits(t *testing.T) {
+	path := filepath.Join("testdata", "lessons", "01.csv")
+	edits := TagEdits{{Pattern: path, Edit: TagEdit{Add: []string{"book2"}, Remove: []string{"1"}}}}
+	loaded, err := LoadAll([]string{path}, Options{Edits: edits}, 1)
+	require.NoError(t, err)
+	expected := withSources(types.NewEntry("まち", "city / town", "book2"),
+		types.Source{File: path, Line: 1, Tags: []string{"book2"}})
+	assert.Equal(t, [][]*types.Entry{{expected}}, loaded)
+}
@@ -0,0 +1,70 @@
+package file
+
+import (
+	"io"
+	"sync"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Options control how the entries of decks are read.
+type Options struct {
+	// Edits gives the tags to add to and remove from each file's entries.
+	Edits TagEdits
+	// Sources reads the sources field of decks written with one, such as
+	// by merge -provenance, so entries keep the sources of the original files.
+	Sources bool
+	// Rules, if set, rewrites the tags of every entry as it's read, after
+	// Edits. Tags are only rewritten when read, not again when merged.
+	Rules types.TagRewriter
+	// Romaji converts Japanese written in romaji to hiragana as it's read.
+	Romaji bool
+}
+
+// NewReader returns a Reader for the entries of the file at path, read from r.
+func (o Options) NewReader(r io.Reader, path string) *Reader {
+	reader := NewReader(r, Separator(path), SourceName(path))
+	reader.Tags = o.Edits.For(path)
+	reader.Sources = o.Sources
+	reader.Rules = o.Rules
+	reader.Romaji = o.Romaji
+	return reader
+}
+
+// LoadAll loads the entries of every file, parsing up to jobs files at
+// once. Entries are returned in the same order as filePaths, so the result
+// doesn't depend on which file finishes first. If any files fail to load,
+// the error for the first of them is returned. Entries are read as opts say.
+func LoadAll(filePaths []string, opts Options, jobs int) ([][]*types.Entry, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	loaded := make([][]*types.Entry, len(filePaths))
+	errs := make([]error, len(filePaths))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				loaded[i], errs[i] = loadEntries(filePaths[i], opts)
+			}
+		}()
+	}
+	for i := range filePaths {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error with file %s", filePaths[i])
+		}
+	}
+	return loaded, nil
+}
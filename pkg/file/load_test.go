@@ -0,0 +1,61 @@
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvmerger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Files of different sizes, so they finish parsing in a different order than they start.
+	var paths []string
+	for i := 0; i < 50; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%02d.csv", i))
+		var es []*types.Entry
+		for j := 0; j < (50-i)*20; j++ {
+			es = append(es, types.NewEntry(fmt.Sprintf("word%d", j), fmt.Sprintf("gloss %d", j), fmt.Sprint(i)))
+		}
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, WriteEntries(f, es, ","))
+		require.NoError(t, f.Close())
+		paths = append(paths, path)
+	}
+
+	var sequential [][]*types.Entry
+	for _, p := range paths {
+		es, err := CSVToEntries(p)
+		require.NoError(t, err)
+		sequential = append(sequential, es)
+	}
+
+	for _, jobs := range []int{1, 4, 16, 100} {
+		t.Run(fmt.Sprintf("%d jobs", jobs), func(t *testing.T) {
+			loaded, err := LoadAll(paths, Options{}, jobs)
+			require.NoError(t, err)
+			assert.Equal(t, sequential, loaded)
+		})
+	}
+}
+
+func TestLoadAllReturnsFirstError(t *testing.T) {
+	paths := []string{
+		filepath.Join("testdata", "validfile.csv"),
+		filepath.Join("testdata", "partialvalidfile.csv"),
+		filepath.Join("testdata", "missing.csv"),
+	}
+
+	_, err := LoadAll(paths, Options{}, 3)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "partialvalidfile.csv")
+}
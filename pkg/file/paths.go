@@ -0,0 +1,190 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// deckExtensions are the file extensions picked up when expanding directories.
+// Compressed decks, such as .csv.gz, are picked up as well.
+var deckExtensions = []string{".csv", ".tsv"}
+
+// ExpandPaths turns command line arguments into a list of files to load.
+// Stdin is passed through as is, directories are expanded recursively to
+// the .csv and .tsv files they contain (compressed or not), and glob patterns (including **
+// for any number of directories) are expanded to their matches.
+// Expanded paths are sorted so the result is deterministic.
+func ExpandPaths(args []string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(expanded []string) {
+		for _, p := range expanded {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	for _, arg := range args {
+		if arg == Stdin {
+			paths = append(paths, arg)
+			continue
+		}
+
+		if hasMeta(arg) {
+			matches, err := glob(arg)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, errors.Errorf("No files match %s", arg)
+			}
+			for _, m := range matches {
+				expanded, err := expandPath(m)
+				if err != nil {
+					return nil, err
+				}
+				add(expanded)
+			}
+			continue
+		}
+
+		expanded, err := expandPath(arg)
+		if err != nil {
+			return nil, err
+		}
+		add(expanded)
+	}
+	return paths, nil
+}
+
+// expandPath returns the deck files found under a directory, or the path
+// itself if it isn't a directory.
+func expandPath(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't read path")
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && isDeckFile(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Couldn't read directory %s", path)
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("No deck files found in %s", path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func isDeckFile(path string) bool {
+	ext := filepath.Ext(trimCompressedExt(path))
+	for _, e := range deckExtensions {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// glob expands a pattern like filepath.Glob, but a ** path element
+// matches any number of directories, including none.
+func glob(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(pattern)
+		return matches, errors.Wrapf(err, "Bad pattern %s", pattern)
+	}
+
+	// Walk from the deepest directory that doesn't contain any pattern characters.
+	patternParts := splitPath(pattern)
+	var rootParts []string
+	for _, part := range patternParts {
+		if hasMeta(part) {
+			break
+		}
+		rootParts = append(rootParts, part)
+	}
+	root := filepath.Join(rootParts...)
+	if filepath.IsAbs(pattern) {
+		root = string(filepath.Separator) + root
+	}
+	if root == "" {
+		root = "."
+	}
+
+	var matches []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ok, err := matchParts(patternParts, splitPath(p))
+		if err != nil {
+			return err
+		}
+		if ok {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, errors.Wrapf(err, "Couldn't expand %s", pattern)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func splitPath(path string) []string {
+	var parts []string
+	for _, p := range strings.Split(filepath.ToSlash(path), "/") {
+		if p != "" && p != "." {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// matchParts matches path elements against pattern elements, with **
+// standing for zero or more path elements.
+func matchParts(pattern, path []string) (bool, error) {
+	if len(pattern) == 0 {
+		return len(path) == 0, nil
+	}
+	if pattern[0] == "**" {
+		ok, err := matchParts(pattern[1:], path)
+		if ok || err != nil {
+			return ok, err
+		}
+		if len(path) == 0 {
+			return false, nil
+		}
+		return matchParts(pattern, path[1:])
+	}
+	if len(path) == 0 {
+		return false, nil
+	}
+	ok, err := filepath.Match(pattern[0], path[0])
+	if !ok || err != nil {
+		return false, errors.Wrapf(err, "Bad pattern %s", pattern[0])
+	}
+	return matchParts(pattern[1:], path[1:])
+}
@@ -0,0 +1,75 @@
+package file
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandPaths(t *testing.T) {
+	lessons := filepath.Join("testdata", "lessons")
+	tests := []struct {
+		name          string
+		args          []string
+		expectedPaths []string
+		expectedErr   bool
+	}{
+		{
+			name:          "Plain files are passed through in order",
+			args:          []string{filepath.Join("testdata", "validfile.csv"), filepath.Join(lessons, "01.csv")},
+			expectedPaths: []string{filepath.Join("testdata", "validfile.csv"), filepath.Join(lessons, "01.csv")},
+		},
+		{
+			name:          "Stdin is passed through",
+			args:          []string{"-"},
+			expectedPaths: []string{"-"},
+		},
+		{
+			name: "Directories are expanded recursively to deck files",
+			args: []string{lessons},
+			expectedPaths: []string{
+				filepath.Join(lessons, "01.csv"),
+				filepath.Join(lessons, "02", "03.tsv"),
+			},
+		},
+		{
+			name:          "Globs are expanded",
+			args:          []string{filepath.Join(lessons, "*.csv")},
+			expectedPaths: []string{filepath.Join(lessons, "01.csv")},
+		},
+		{
+			name: "Double star globs match any number of directories",
+			args: []string{filepath.Join(lessons, "**", "*.?sv")},
+			expectedPaths: []string{
+				filepath.Join(lessons, "01.csv"),
+				filepath.Join(lessons, "02", "03.tsv"),
+			},
+		},
+		{
+			name:          "Files are only listed once",
+			args:          []string{lessons, filepath.Join(lessons, "01.csv")},
+			expectedPaths: []string{filepath.Join(lessons, "01.csv"), filepath.Join(lessons, "02", "03.tsv")},
+		},
+		{
+			name:        "Globs without matches return an error",
+			args:        []string{filepath.Join(lessons, "*.xlsx")},
+			expectedErr: true,
+		},
+		{
+			name:        "Missing files return an error",
+			args:        []string{filepath.Join("testdata", "missing.csv")},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paths, err := ExpandPaths(test.args)
+			assert.Equal(t, test.expectedErr, err != nil)
+			if test.expectedPaths != nil {
+				assert.Equal(t, test.expectedPaths, paths)
+			}
+		})
+	}
+}
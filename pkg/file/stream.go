@@ -0,0 +1,162 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/romaji"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Reader reads entries one line at a time, so files don't have to fit in memory.
+type Reader struct {
+	// Tags is applied to every entry read, before its source is recorded.
+	Tags TagEdit
+	// Sources reads an optional fourth field of each line holding the
+	// entry's sources, as written by Writer.Sources.
+	Sources bool
+	// Variants reads an optional fifth field of each line holding the
+	// entry's variants, as written by Writer.Variants. It needs Sources.
+	Variants bool
+	// Rules, if set, rewrites the tags of every entry read, once Tags has
+	// been applied.
+	Rules types.TagRewriter
+	// Romaji converts Japanese written in romaji, like machi, to hiragana.
+	// Text that can't be read as romaji, like an English word, is left as
+	// it is.
+	Romaji bool
+
+	scanner *bufio.Scanner
+	sep     string
+	name    string
+	line    int
+}
+
+// NewReader returns a Reader for entries in r with fields split by sep.
+// Entries record name and the line they were read from as their source,
+// unless Sources is set and the line lists its own sources. No source is recorded if name is empty.
+func NewReader(r io.Reader, sep, name string) *Reader {
+	return &Reader{scanner: bufio.NewScanner(r), sep: sep, name: name}
+}
+
+// Next returns the next entry, or io.EOF once all entries have been read.
+func (r *Reader) Next() (*types.Entry, error) {
+	for r.scanner.Scan() {
+		r.line++
+		// Don't process empty lines
+		t := r.scanner.Text()
+		if t == "" {
+			continue
+		}
+		parse := SeparatedLineToEntry
+		if r.Variants {
+			parse = separatedLineWithVariantsToEntry
+		} else if r.Sources {
+			parse = SeparatedLineWithSourcesToEntry
+		}
+		e, err := parse(t, r.sep)
+		if err != nil {
+			return nil, &ParseError{File: r.name, Line: r.line, Err: err}
+		}
+		if r.Romaji && romaji.IsRomaji(e.Japanese) {
+			if kana, err := romaji.ToKana(e.Japanese); err == nil {
+				e.Japanese = kana
+			}
+		}
+		r.Tags.Apply(e)
+		if r.Rules != nil {
+			e.Tags.Rewrite(r.Rules)
+		}
+		if r.name != "" && e.Sources == nil {
+			e.Sources = []types.Source{{File: r.name, Line: r.line, Tags: e.Tags.SortNatural()}}
+		}
+		return e, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Error reading file")
+	}
+	return nil, io.EOF
+}
+
+// Line returns the line number of the last entry read, starting at 1.
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// ParseError is returned by Reader.Next for a line that isn't a valid entry.
+// Reading can go on with the next line.
+type ParseError struct {
+	// File is the name given to the Reader, which may be empty.
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+// Writer writes entries one line at a time. Flush must be called once
+// all entries have been written.
+type Writer struct {
+	// Sources adds a field with each entry's sources.
+	Sources bool
+	// Variants adds a field after the sources with each entry's variants,
+	// rather than combining them with its text, so they can be read back.
+	// It needs Sources.
+	Variants bool
+	// TagOrder is the order tags are written in.
+	TagOrder types.TagOrder
+	// FlatTagSeparator, if set, flattens hierarchical tags by joining
+	// their levels with it, for tools that don't understand hierarchy.
+	FlatTagSeparator string
+	// Romaji, if set, adds a last field with the Japanese spelled in
+	// romaji, for flashcard apps. Files with it can't be read back in.
+	Romaji romaji.System
+
+	w   *bufio.Writer
+	sep string
+}
+
+// NewWriter returns a Writer that writes entries to w with fields joined by sep.
+func NewWriter(w io.Writer, sep string) *Writer {
+	return &Writer{w: bufio.NewWriter(w), sep: sep}
+}
+
+// Write writes a single entry.
+func (w *Writer) Write(e *types.Entry) error {
+	tags := e.Tags
+	if w.FlatTagSeparator != "" {
+		tags = tags.Flatten(w.FlatTagSeparator)
+	}
+	japanese, english := e.Text()
+	if w.Variants {
+		japanese, english = e.Japanese, e.English
+	}
+	fields := []string{japanese, english, tags.ToStringOrdered(w.TagOrder)}
+	if w.Sources {
+		fields = append(fields, types.FormatSources(e.Sources))
+	}
+	if w.Variants {
+		fields = append(fields, types.FormatVariants(e.Variants))
+	}
+	if w.Romaji != 0 {
+		fields = append(fields, romaji.FromKana(japanese, w.Romaji))
+	}
+	for i, f := range fields {
+		fields[i] = quoteField(f, w.sep)
+	}
+	_, err := fmt.Fprintln(w.w, strings.Join(fields, w.sep))
+	return errors.Wrap(err, "Error writing entries")
+}
+
+// Flush writes any buffered entries to the underlying writer.
+func (w *Writer) Flush() error {
+	return errors.Wrap(w.w.Flush(), "Error writing entries")
+}
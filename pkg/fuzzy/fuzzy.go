@@ -0,0 +1,252 @@
+// Package fuzzy finds entries that are nearly, but not exactly, the same,
+// such as those with typos like "citty / town".
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/nrb/csvmerger/pkg/types"
+)
+
+// NormalizeJapanese returns Japanese text in a form where trivial
+// differences don't count: katakana is turned into hiragana, full-width
+// latin letters and digits into ASCII, and spaces and punctuation are dropped.
+func NormalizeJapanese(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		r = toHalfWidth(r)
+		switch {
+		case r >= 'ァ' && r <= 'ヶ':
+			// Katakana has the same layout as hiragana, 0x60 code points up.
+			r -= 0x60
+		case unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r):
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// NormalizeEnglish returns English text in a form where trivial differences
+// don't count: it's lower cased, full-width letters are turned into ASCII,
+// punctuation other than gloss separators is dropped, and glosses are
+// separated by " / ".
+func NormalizeEnglish(s string) string {
+	var glosses []string
+	for _, gloss := range strings.FieldsFunc(s, isGlossSeparator) {
+		var b strings.Builder
+		for _, r := range gloss {
+			r = toHalfWidth(r)
+			if unicode.IsPunct(r) && r != '\'' && r != '-' {
+				r = ' '
+			}
+			b.WriteRune(unicode.ToLower(r))
+		}
+		if words := strings.Fields(b.String()); len(words) > 0 {
+			glosses = append(glosses, strings.Join(words, " "))
+		}
+	}
+	return strings.Join(glosses, " / ")
+}
+
+func isGlossSeparator(r rune) bool {
+	return r == '/' || r == '／' || r == ';' || r == '；'
+}
+
+// toHalfWidth turns full-width ASCII characters, like Ａ, into ASCII.
+func toHalfWidth(r rune) rune {
+	if r >= '！' && r <= '～' {
+		return r - 0xFEE0
+	}
+	if r == '　' {
+		return ' '
+	}
+	return r
+}
+
+// Distance returns the edit distance between two strings: the fewest
+// characters that must be inserted, deleted or replaced to turn one into
+// the other.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a int, rest ...int) int {
+	for _, b := range rest {
+		if b < a {
+			a = b
+		}
+	}
+	return a
+}
+
+// Options are the thresholds for two entries to be near-duplicates.
+type Options struct {
+	// JapaneseDistance is the largest edit distance between the
+	// normalized Japanese text of near-duplicates.
+	JapaneseDistance int
+	// EnglishDistance is the largest edit distance between the
+	// normalized English text of near-duplicates.
+	EnglishDistance int
+}
+
+// Pair is two entries that are near-duplicates.
+type Pair struct {
+	A, B             *types.Entry
+	JapaneseDistance int
+	EnglishDistance  int
+	// Similarity is 1 for entries whose normalized text is the same, down
+	// to 0 for entries with nothing in common.
+	Similarity float64
+}
+
+// normalized is an entry along with its normalized text.
+type normalized struct {
+	entry    *types.Entry
+	japanese string
+	english  string
+}
+
+// FindPairs returns the pairs of entries that are near-duplicates, most
+// similar first. Entries whose Japanese and English text are both exactly
+// the same aren't near-duplicates; they're equal.
+//
+// Comparing every pair of entries would be too slow for large decks, so
+// only entries that share a bigram (two characters in a row) of their
+// Japanese text are compared. Japanese text shorter than twice
+// opts.JapaneseDistance can be within the distance of another without
+// sharing any bigrams, so entries with it are compared with those sharing a
+// bigram of their English text instead. Empty English text has a bigram of
+// its own, so entries without English are compared with each other.
+func FindPairs(entries []*types.Entry, opts Options) []Pair {
+	norm := make([]normalized, len(entries))
+	for i, e := range entries {
+		norm[i] = normalized{entry: e, japanese: NormalizeJapanese(e.Japanese), english: NormalizeEnglish(e.English)}
+	}
+
+	japaneseIndex := make(map[string][]gramCount)
+	englishIndex := make(map[string][]int)
+	var pairs []Pair
+	for i, n := range norm {
+		// Count the bigrams each earlier entry shares with this one. A
+		// bigram repeated in both is shared as often as it appears in the
+		// one with fewer of it.
+		shared := make(map[int]int)
+		for g, count := range bigrams(n.japanese) {
+			for _, other := range japaneseIndex[g] {
+				shared[other.entry] += minInt(count, other.count)
+			}
+			japaneseIndex[g] = append(japaneseIndex[g], gramCount{entry: i, count: count})
+		}
+		// Short text may be within the distance without sharing any bigrams.
+		short := len([]rune(n.japanese)) < 2*opts.JapaneseDistance
+		for g := range bigrams(n.english) {
+			if short {
+				for _, j := range englishIndex[g] {
+					if _, ok := shared[j]; !ok {
+						shared[j] = 0
+					}
+				}
+			}
+			englishIndex[g] = append(englishIndex[g], i)
+		}
+
+		for j, count := range shared {
+			m := norm[j]
+			// Strings within distance d of each other share at least
+			// bigrams-2d of their bigrams, counting repeats, which rules
+			// out most candidates without computing the distance.
+			longest := maxInt(len([]rune(n.japanese)), len([]rune(m.japanese)))
+			if count < longest+1-2*opts.JapaneseDistance {
+				continue
+			}
+			if types.EntriesAreEqual(n.entry, m.entry) {
+				continue
+			}
+			dj := Distance(n.japanese, m.japanese)
+			if dj > opts.JapaneseDistance {
+				continue
+			}
+			de := Distance(n.english, m.english)
+			if de > opts.EnglishDistance {
+				continue
+			}
+			pairs = append(pairs, Pair{
+				A:                m.entry,
+				B:                n.entry,
+				JapaneseDistance: dj,
+				EnglishDistance:  de,
+				Similarity:       similarity(m, n, dj+de),
+			})
+		}
+	}
+
+	index := make(map[*types.Entry]int)
+	for i, e := range entries {
+		index[e] = i
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i], pairs[j]
+		if a.Similarity != b.Similarity {
+			return a.Similarity > b.Similarity
+		}
+		if index[a.A] != index[b.A] {
+			return index[a.A] < index[b.A]
+		}
+		return index[a.B] < index[b.B]
+	})
+	return pairs
+}
+
+func similarity(a, b normalized, distance int) float64 {
+	length := maxInt(len([]rune(a.japanese)), len([]rune(b.japanese))) +
+		maxInt(len([]rune(a.english)), len([]rune(b.english)))
+	if length == 0 {
+		return 1
+	}
+	return 1 - float64(distance)/float64(length)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// gramCount is how many times a bigram appears in the Japanese text of an entry.
+type gramCount struct {
+	entry int
+	count int
+}
+
+// bigrams returns how many times each pair of consecutive characters
+// appears in s, with ^ and $ marking its start and end, so even empty text
+// has one.
+func bigrams(s string) map[string]int {
+	runes := append(append([]rune{'^'}, []rune(s)...), '$')
+	grams := make(map[string]int)
+	for i := 0; i+1 < len(runes); i++ {
+		grams[string(runes[i:i+2])]++
+	}
+	return grams
+}
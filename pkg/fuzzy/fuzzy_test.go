@@ -0,0 +1,110 @@
+package fuzzy
+
+import (
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		f        func(string) string
+	}{
+		{name: "Katakana becomes hiragana", input: "テレビ", expected: "てれび", f: NormalizeJapanese},
+		{name: "Long vowel marks are kept", input: "コーヒー", expected: "こーひー", f: NormalizeJapanese},
+		{name: "Punctuation and spaces are dropped from Japanese", input: "お はよう。", expected: "おはよう", f: NormalizeJapanese},
+		{name: "Full-width letters become ASCII", input: "Ｔシャツ", expected: "tしゃつ", f: NormalizeJapanese},
+		{name: "English is lower cased", input: "City / Town", expected: "city / town", f: NormalizeEnglish},
+		{name: "Gloss separators are made the same", input: "city/town; place", expected: "city / town / place", f: NormalizeEnglish},
+		{name: "Punctuation is dropped from English", input: "to eat (a meal)!", expected: "to eat a meal", f: NormalizeEnglish},
+		{name: "Apostrophes and hyphens are kept", input: "don't  re-do", expected: "don't re-do", f: NormalizeEnglish},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.f(test.input))
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"city", "city", 0},
+		{"city", "citty", 1},
+		{"まち", "まちい", 1},
+		{"kitten", "sitting", 3},
+		{"", "まち", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+"/"+test.b, func(t *testing.T) {
+			assert.Equal(t, test.expected, Distance(test.a, test.b))
+			assert.Equal(t, test.expected, Distance(test.b, test.a))
+		})
+	}
+}
+
+func TestFindPairs(t *testing.T) {
+	city := types.NewEntry("まち", "city / town", "1")
+	typo := types.NewEntry("まち", "citty / town", "4")
+	extra := types.NewEntry("まちい", "city / town", "5")
+	redefined := types.NewEntry("まち", "neighborhood", "2")
+	tree := types.NewEntry("木", "tree", "3")
+	book := types.NewEntry("本", "tree", "6")
+	television := types.NewEntry("テレビ", "TV", "7")
+	televisionKana := types.NewEntry("てれび", "tv", "8")
+	entries := []*types.Entry{city, typo, extra, redefined, tree, book, television, televisionKana}
+
+	pairs := FindPairs(entries, Options{JapaneseDistance: 1, EnglishDistance: 2})
+	var found [][2]*types.Entry
+	for _, p := range pairs {
+		found = append(found, [2]*types.Entry{p.A, p.B})
+	}
+	assert.Equal(t, [][2]*types.Entry{
+		{television, televisionKana},
+		{city, typo},
+		{city, extra},
+		{typo, extra},
+		{tree, book},
+	}, found)
+	assert.Equal(t, 1.0, pairs[0].Similarity)
+	assert.Equal(t, 0, pairs[1].JapaneseDistance)
+	assert.Equal(t, 1, pairs[1].EnglishDistance)
+	for i := 1; i < len(pairs); i++ {
+		assert.True(t, pairs[i-1].Similarity >= pairs[i].Similarity)
+	}
+
+	assert.Len(t, FindPairs(entries, Options{}), 1)
+}
+
+func TestFindPairsWithoutEnglish(t *testing.T) {
+	tree := types.NewEntry("木", "", "1")
+	spirit := types.NewEntry("気", "", "2")
+	city := types.NewEntry("まち", "", "3")
+
+	pairs := FindPairs([]*types.Entry{tree, spirit, city}, Options{JapaneseDistance: 1, EnglishDistance: 2})
+	require.Len(t, pairs, 1)
+	assert.Equal(t, tree, pairs[0].A)
+	assert.Equal(t, spirit, pairs[0].B)
+}
+
+func TestFindPairsWithRepeatedBigrams(t *testing.T) {
+	a := types.NewEntry("ああああ", "ah", "1")
+	b := types.NewEntry("あああい", "ah", "2")
+	require.Equal(t, 1, Distance(NormalizeJapanese(a.Japanese), NormalizeJapanese(b.Japanese)))
+
+	pairs := FindPairs([]*types.Entry{a, b}, Options{JapaneseDistance: 1})
+	require.Len(t, pairs, 1)
+	assert.Equal(t, a, pairs[0].A)
+	assert.Equal(t, b, pairs[0].B)
+	assert.Equal(t, 1, pairs[0].JapaneseDistance)
+}
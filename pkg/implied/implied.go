@@ -0,0 +1,134 @@
+// Package implied adds tags to entries based on the tags they already have,
+// like tagging everything tagged godan or ichidan as a verb.
+//
+// Rules files have one rule per line, a tag expression (see package query)
+// and the tags it implies, separated by =>. Anything after a # is a comment.
+//
+//	godan or ichidan => verb
+//	lesson:1..10 => book1
+//
+// Rules are applied repeatedly until no more tags are added, so implied
+// tags can imply further tags.
+package implied
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/query"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Rule adds Tags to entries whose tags match Expr.
+type Rule struct {
+	Expr query.Expr
+	Tags []string
+	// Text is the rule as written, and File and Line where it was written.
+	Text string
+	File string
+	Line int
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s:%d: %s", r.File, r.Line, r.Text)
+}
+
+// Rules is a list of implied tag rules.
+type Rules struct {
+	rules []Rule
+}
+
+// Addition records a tag added to an entry, and the rule that added it.
+type Addition struct {
+	Entry *types.Entry
+	Tag   string
+	Rule  Rule
+}
+
+func (a Addition) String() string {
+	return fmt.Sprintf("%s,%s: added %s by %s", a.Entry.Japanese, a.Entry.English, a.Tag, a.Rule)
+}
+
+// Load reads rules from a file.
+func Load(filePath string) (*Rules, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't open rules file")
+	}
+	defer f.Close()
+	rules, err := Parse(f, filePath)
+	return rules, errors.Wrapf(err, "Error in rules file %s", filePath)
+}
+
+// Parse reads rules from r. Rules record name as the file they came from.
+func Parse(r io.Reader, name string) (*Rules, error) {
+	rules := &Rules{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		parts := strings.SplitN(text, "=>", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("line %d: expected EXPR => TAG...", line)
+		}
+		expr, err := query.Parse(parts[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		tags := strings.Fields(parts[1])
+		if len(tags) == 0 {
+			return nil, errors.Errorf("line %d: no tags to add", line)
+		}
+		rules.rules = append(rules.rules, Rule{Expr: expr, Tags: tags, Text: text, File: name, Line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Error reading rules")
+	}
+	return rules, nil
+}
+
+// Apply adds the tags implied by the rules to an entry, and returns what
+// was added. The entry's sources are left alone, since the rules file isn't
+// a deck the entry came from; the additions record which rule added each tag.
+func (r *Rules) Apply(e *types.Entry) []Addition {
+	var additions []Addition
+	for added := true; added; {
+		added = false
+		for _, rule := range r.rules {
+			if !rule.Expr.Match(e.Tags) {
+				continue
+			}
+			for _, tag := range rule.Tags {
+				if e.Tags.Contains(tag) {
+					continue
+				}
+				e.Tags.Insert(tag)
+				additions = append(additions, Addition{Entry: e, Tag: tag, Rule: rule})
+				added = true
+			}
+		}
+	}
+	return additions
+}
+
+// ApplyAll applies the rules to every entry.
+func (r *Rules) ApplyAll(entries []*types.Entry) []Addition {
+	var additions []Addition
+	for _, e := range entries {
+		additions = append(additions, r.Apply(e)...)
+	}
+	return additions
+}
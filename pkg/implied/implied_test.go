@@ -0,0 +1,90 @@
+package implied
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+# Verb kinds
+godan or ichidan => verb
+lesson:1..10 => book1
+verb and book1 => book1::verbs   # applies after the rules above
+`
+
+func TestApply(t *testing.T) {
+	rules, err := Parse(strings.NewReader(testRules), "implied.txt")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		tags          string
+		expectedTags  string
+		expectedAdded []string
+	}{
+		{
+			name:         "No rules match",
+			tags:         "noun lesson:12",
+			expectedTags: "lesson:12 noun",
+		},
+		{
+			name:          "Single rule",
+			tags:          "godan",
+			expectedTags:  "godan verb",
+			expectedAdded: []string{"verb by implied.txt:3: godan or ichidan => verb"},
+		},
+		{
+			name:         "Implied tags imply more tags",
+			tags:         "ichidan lesson:4",
+			expectedTags: "book1 book1::verbs lesson:4 ichidan verb",
+			expectedAdded: []string{
+				"verb by implied.txt:3: godan or ichidan => verb",
+				"book1 by implied.txt:4: lesson:1..10 => book1",
+				"book1::verbs by implied.txt:5: verb and book1 => book1::verbs",
+			},
+		},
+		{
+			name:         "Tags already present aren't added",
+			tags:         "godan verb",
+			expectedTags: "godan verb",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := types.NewEntry("たべる", "to eat", test.tags)
+			additions := rules.Apply(e)
+
+			var added []string
+			for _, a := range additions {
+				assert.Equal(t, e, a.Entry)
+				added = append(added, a.Tag+" by "+a.Rule.String())
+			}
+			assert.Equal(t, test.expectedTags, e.Tags.ToString())
+			assert.Equal(t, test.expectedAdded, added)
+			assert.Empty(t, e.Sources)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{name: "Missing arrow", rules: "godan verb"},
+		{name: "Bad expression", rules: "godan or => verb"},
+		{name: "No tags", rules: "godan =>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.rules), "implied.txt")
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package jmdict
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/script"
+	"github.com/nrb/csvmerger/pkg/types"
+)
+
+// The IDs of the problems Check finds.
+const (
+	NotFoundRule      = "not-in-dictionary"
+	ReadingRule       = "reading"
+	GlossMismatchRule = "gloss-mismatch"
+)
+
+// Rules describes the problems Check finds.
+var Rules = []diagnostic.Rule{
+	{ID: NotFoundRule, Description: "the Japanese isn't a word in JMdict"},
+	{ID: ReadingRule, Description: "the readings JMdict gives for Japanese written in kanji"},
+	{ID: GlossMismatchRule, Description: "the English shares no words with the meanings JMdict gives"},
+}
+
+// Check looks an entry up in the dictionary, and reports if its Japanese
+// isn't there, or if its English shares no words with any meaning of the
+// words that are. With readings set, the readings of Japanese written in
+// kanji are reported too.
+func (d *Dictionary) Check(e *types.Entry, readings bool) []diagnostic.Diagnostic {
+	found := d.Lookup(e.Japanese)
+	if len(found) == 0 {
+		return []diagnostic.Diagnostic{{
+			Location: diagnostic.FirstLocation(e.Sources),
+			Rule:     NotFoundRule,
+			Level:    diagnostic.Warning,
+			Message:  fmt.Sprintf("%s isn't in JMdict", e.Japanese),
+		}}
+	}
+
+	var problems []diagnostic.Diagnostic
+	if readings && script.Count(e.Japanese)[script.Kanji] > 0 {
+		var all []string
+		for _, entry := range found {
+			for _, r := range entry.ReadingsOf(e.Japanese) {
+				if !contains(all, r) {
+					all = append(all, r)
+				}
+			}
+		}
+		if len(all) > 0 {
+			problems = append(problems, diagnostic.Diagnostic{
+				Location: diagnostic.FirstLocation(e.Sources),
+				Rule:     ReadingRule,
+				Level:    diagnostic.Note,
+				Message:  fmt.Sprintf("%s is read %s", e.Japanese, strings.Join(all, " / ")),
+			})
+		}
+	}
+
+	if len(matchingSenses(found, e)) == 0 {
+		_, english := e.Text()
+		var glosses []string
+		for _, entry := range found {
+			for _, s := range entry.Senses {
+				glosses = append(glosses, s.Glosses...)
+			}
+		}
+		if len(glosses) > 5 {
+			glosses = append(glosses[:5], "...")
+		}
+		problems = append(problems, diagnostic.Diagnostic{
+			Location: diagnostic.FirstLocation(e.Sources),
+			Rule:     GlossMismatchRule,
+			Level:    diagnostic.Warning,
+			Message:  fmt.Sprintf("%s shares no words with JMdict's meanings of %s: %s", english, e.Japanese, strings.Join(glosses, " / ")),
+		})
+	}
+	return problems
+}
+
+// POS returns the parts of speech of an entry, as JMdict entity names like
+// v1, from the meanings that share words with its English.
+func (d *Dictionary) POS(e *types.Entry) []string {
+	var pos []string
+	for _, s := range matchingSenses(d.Lookup(e.Japanese), e) {
+		for _, p := range s.POS {
+			if !contains(pos, p) {
+				pos = append(pos, p)
+			}
+		}
+	}
+	return pos
+}
+
+// matchingSenses returns the senses of entries sharing words with the
+// English of e, including the glosses merged into it.
+func matchingSenses(entries []*Entry, e *types.Entry) []Sense {
+	english := make(map[string]bool)
+	for _, w := range words(strings.Join(e.Glosses(), " ")) {
+		english[w] = true
+	}
+	var senses []Sense
+	for _, entry := range entries {
+		for _, s := range entry.Senses {
+			if sharesWords(s, english) {
+				senses = append(senses, s)
+			}
+		}
+	}
+	return senses
+}
+
+func sharesWords(s Sense, english map[string]bool) bool {
+	for _, g := range s.Glosses {
+		for _, w := range words(g) {
+			if english[w] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stopWords are too common in glosses to say anything about their meaning.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "to": true, "of": true, "be": true, "in": true,
+	"on": true, "at": true, "for": true, "and": true, "or": true, "with": true,
+	"one's": true, "something": true, "someone": true, "etc": true,
+}
+
+// words returns the lower cased words of text, without stop words.
+func words(text string) []string {
+	var ws []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}) {
+		if !stopWords[w] {
+			ws = append(ws, w)
+		}
+	}
+	return ws
+}
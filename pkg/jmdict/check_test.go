@@ -0,0 +1,89 @@
+package jmdict
+
+import (
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	d := loadSmall(t)
+	tests := []struct {
+		name     string
+		entry    *types.Entry
+		readings bool
+		expected []diagnostic.Diagnostic
+	}{
+		{
+			name:  "Entries sharing a word with a meaning are fine",
+			entry: types.NewEntry("まち", "city / town", "1"),
+		},
+		{
+			name:  "Stop words aren't shared words",
+			entry: types.NewEntry("食べる", "to consume", "1"),
+			expected: []diagnostic.Diagnostic{{
+				Rule:    GlossMismatchRule,
+				Level:   diagnostic.Warning,
+				Message: "to consume shares no words with JMdict's meanings of 食べる: to eat",
+			}},
+		},
+		{
+			name:  "Glosses merged into an entry are checked too",
+			entry: withVariant(types.NewEntry("食べる", "to consume", "1"), "食べる", "to eat"),
+		},
+		{
+			name:  "Mismatches list the glosses merged into an entry",
+			entry: withVariant(types.NewEntry("食べる", "to consume", "1"), "食べる", "to devour"),
+			expected: []diagnostic.Diagnostic{{
+				Rule:    GlossMismatchRule,
+				Level:   diagnostic.Warning,
+				Message: "to consume / to devour shares no words with JMdict's meanings of 食べる: to eat",
+			}},
+		},
+		{
+			name:  "Unknown terms are reported",
+			entry: types.NewEntry("じんじゃ", "shrine", "1"),
+			expected: []diagnostic.Diagnostic{{
+				Rule:    NotFoundRule,
+				Level:   diagnostic.Warning,
+				Message: "じんじゃ isn't in JMdict",
+			}},
+		},
+		{
+			name:     "Readings are suggested for kanji",
+			entry:    types.NewEntry("町", "town", "1"),
+			readings: true,
+			expected: []diagnostic.Diagnostic{{
+				Rule:    ReadingRule,
+				Level:   diagnostic.Note,
+				Message: "町 is read まち / ちょう",
+			}},
+		},
+		{
+			name:     "Readings aren't suggested for kana",
+			entry:    types.NewEntry("まち", "town", "1"),
+			readings: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, d.Check(test.entry, test.readings))
+		})
+	}
+}
+
+// withVariant returns e with another text merged into it.
+func withVariant(e *types.Entry, japanese, english string) *types.Entry {
+	e.Variants = append(e.Variants, types.Variant{Japanese: japanese, English: english})
+	return e
+}
+
+func TestPOS(t *testing.T) {
+	d := loadSmall(t)
+	assert.Equal(t, []string{"v1", "vt"}, d.POS(types.NewEntry("たべる", "to eat", "")))
+	assert.Equal(t, []string{"n"}, d.POS(types.NewEntry("まち", "street", "")))
+	assert.Nil(t, d.POS(types.NewEntry("まち", "shrine", "")))
+}
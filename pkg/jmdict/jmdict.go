@@ -0,0 +1,310 @@
+// Package jmdict looks up terms in a local copy of JMdict, the free
+// Japanese-English dictionary, to check decks against it.
+package jmdict
+
+import (
+	"encoding/gob"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/romaji"
+	"github.com/pkg/errors"
+)
+
+// Reading is a kana reading of a dictionary entry.
+type Reading struct {
+	Text string
+	// Restrict lists the kanji spellings the reading belongs to. It
+	// belongs to all of them if empty.
+	Restrict []string
+	// NoKanji is set for readings that don't belong to any kanji spelling.
+	NoKanji bool
+}
+
+// Sense is one meaning of a dictionary entry.
+type Sense struct {
+	// POS are the parts of speech, as JMdict entity names like v1 or n.
+	POS     []string
+	Glosses []string
+}
+
+// Entry is a dictionary entry: a word, with its spellings and meanings.
+type Entry struct {
+	Kanji    []string
+	Readings []Reading
+	Senses   []Sense
+}
+
+// ReadingsOf returns the readings of a kanji spelling of the entry.
+func (e *Entry) ReadingsOf(kanji string) []string {
+	var readings []string
+	for _, r := range e.Readings {
+		if r.NoKanji {
+			continue
+		}
+		if len(r.Restrict) == 0 || contains(r.Restrict, kanji) {
+			readings = append(readings, r.Text)
+		}
+	}
+	return readings
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Dictionary is a set of entries, indexed by their spellings.
+type Dictionary struct {
+	Entries []Entry
+
+	// index maps the keys of spellings to the entries with them.
+	index map[string][]int
+}
+
+// New returns a Dictionary of entries.
+func New(entries []Entry) *Dictionary {
+	d := &Dictionary{Entries: entries, index: make(map[string][]int)}
+	for i, e := range entries {
+		seen := make(map[string]bool)
+		add := func(spelling string) {
+			key := romaji.Key(spelling)
+			if !seen[key] {
+				seen[key] = true
+				d.index[key] = append(d.index[key], i)
+			}
+		}
+		for _, k := range e.Kanji {
+			add(k)
+		}
+		for _, r := range e.Readings {
+			add(r.Text)
+		}
+	}
+	return d
+}
+
+// Lookup returns the entries spelled term, in kanji or kana. Hiragana and
+// katakana are treated alike, and so is romaji, so machi finds 町.
+func (d *Dictionary) Lookup(term string) []*Entry {
+	var found []*Entry
+	for _, i := range d.index[romaji.Key(term)] {
+		found = append(found, &d.Entries[i])
+	}
+	return found
+}
+
+// xmlEntry is an entry as it's written in JMdict's XML.
+type xmlEntry struct {
+	Kanji    []string `xml:"k_ele>keb"`
+	Readings []struct {
+		Text     string    `xml:"reb"`
+		Restrict []string  `xml:"re_restr"`
+		NoKanji  *struct{} `xml:"re_nokanji"`
+	} `xml:"r_ele"`
+	Senses []struct {
+		POS     []string `xml:"pos"`
+		Glosses []struct {
+			Text string `xml:",chardata"`
+			Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+		} `xml:"gloss"`
+	} `xml:"sense"`
+}
+
+// entityDecl matches the entity declarations of JMdict's DTD.
+var entityDecl = regexp.MustCompile(`<!ENTITY\s+(\S+)\s+"[^"]*"\s*>`)
+
+// Parse reads JMdict's XML, keeping English glosses only. Parts of speech
+// are written in JMdict as entities declared by its DTD, like &v1;, which
+// are kept as their names rather than their descriptions.
+func Parse(r io.Reader) (*Dictionary, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Entity = make(map[string]string)
+	var entries []Entry
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return New(entries), nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading JMdict")
+		}
+
+		switch t := token.(type) {
+		case xml.Directive:
+			for _, m := range entityDecl.FindAllSubmatch(t, -1) {
+				decoder.Entity[string(m[1])] = string(m[1])
+			}
+		case xml.StartElement:
+			if t.Name.Local != "entry" {
+				continue
+			}
+			var x xmlEntry
+			if err := decoder.DecodeElement(&x, &t); err != nil {
+				return nil, errors.Wrap(err, "Error reading JMdict")
+			}
+			entries = append(entries, x.entry())
+		}
+	}
+}
+
+// entry converts an entry from XML.
+func (x *xmlEntry) entry() Entry {
+	e := Entry{Kanji: x.Kanji}
+	for _, r := range x.Readings {
+		e.Readings = append(e.Readings, Reading{Text: r.Text, Restrict: r.Restrict, NoKanji: r.NoKanji != nil})
+	}
+	var pos []string
+	for _, s := range x.Senses {
+		// A sense without parts of speech has those of the one before.
+		if len(s.POS) > 0 {
+			pos = s.POS
+		}
+		sense := Sense{POS: pos}
+		for _, g := range s.Glosses {
+			if g.Lang == "" || g.Lang == "eng" {
+				sense.Glosses = append(sense.Glosses, g.Text)
+			}
+		}
+		if len(sense.Glosses) > 0 {
+			e.Senses = append(e.Senses, sense)
+		}
+	}
+	return e
+}
+
+// indexVersion changes whenever the index format does, so old index files
+// are rebuilt.
+const indexVersion = 1
+
+// indexFile is the contents of an index file.
+type indexFile struct {
+	Version int
+	Entries []Entry
+}
+
+// Save writes the dictionary to w as an index, which loads much faster
+// than the XML.
+func (d *Dictionary) Save(w io.Writer) error {
+	err := gob.NewEncoder(w).Encode(indexFile{Version: indexVersion, Entries: d.Entries})
+	return errors.Wrap(err, "Error writing JMdict index")
+}
+
+// Load reads a dictionary written by Save.
+func Load(r io.Reader) (*Dictionary, error) {
+	var idx indexFile
+	if err := gob.NewDecoder(r).Decode(&idx); err != nil {
+		return nil, errors.Wrap(err, "Error reading JMdict index")
+	}
+	if idx.Version != indexVersion {
+		return nil, errors.Errorf("JMdict index is version %d, expected %d", idx.Version, indexVersion)
+	}
+	return New(idx.Entries), nil
+}
+
+// IndexPath returns the path of the index file kept for a JMdict XML file.
+func IndexPath(path string) string {
+	return path + ".index"
+}
+
+// IndexError is returned by Open along with the dictionary when its index
+// couldn't be saved, such as next to a JMdict file in a read-only
+// directory. The dictionary is still usable, but is parsed again next time.
+type IndexError struct {
+	Err error
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("JMdict wasn't indexed: %s", e.Err)
+}
+
+// Open returns the dictionary in a JMdict XML file, which may be
+// compressed. The XML is only parsed the first time, or after it changes:
+// the dictionary is saved to an index file next to it, see IndexPath, which
+// is read instead from then on. If the index can't be saved, the parsed
+// dictionary is returned with an *IndexError.
+func Open(path string) (*Dictionary, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't open JMdict")
+	}
+	indexPath := IndexPath(path)
+	if indexInfo, err := os.Stat(indexPath); err == nil && !indexInfo.ModTime().Before(info.ModTime()) {
+		if d, err := loadIndex(indexPath); err == nil {
+			return d, nil
+		}
+		// Fall through and rebuild an unreadable or outdated index.
+	}
+	d, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveIndex(d, indexPath); err != nil {
+		return d, &IndexError{Err: err}
+	}
+	return d, nil
+}
+
+// Index parses a JMdict XML file and saves its index, replacing any
+// existing one, and returns the dictionary.
+func Index(path string) (*Dictionary, error) {
+	d, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveIndex(d, IndexPath(path)); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func parseFile(path string) (*Dictionary, error) {
+	rc, err := file.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't open JMdict")
+	}
+	defer rc.Close()
+	return Parse(rc)
+}
+
+// saveIndex saves the index of a dictionary to path. It's written to a
+// temporary file which then replaces path, so a failed write never leaves
+// a partial index behind.
+func saveIndex(d *Dictionary, path string) error {
+	out, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "Couldn't create JMdict index")
+	}
+	defer os.Remove(out.Name())
+	if err := out.Chmod(0644); err != nil {
+		out.Close()
+		return errors.Wrap(err, "Couldn't create JMdict index")
+	}
+	if err := d.Save(out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return errors.Wrap(err, "Error writing JMdict index")
+	}
+	return errors.Wrap(os.Rename(out.Name(), path), "Couldn't replace JMdict index")
+}
+
+func loadIndex(path string) (*Dictionary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't open JMdict index")
+	}
+	defer f.Close()
+	return Load(f)
+}
@@ -0,0 +1,139 @@
+package jmdict
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var smallPath = filepath.Join("testdata", "JMdict_small.xml")
+
+func loadSmall(t *testing.T) *Dictionary {
+	f, err := os.Open(smallPath)
+	require.NoError(t, err)
+	defer f.Close()
+	d, err := Parse(f)
+	require.NoError(t, err)
+	return d
+}
+
+func TestParse(t *testing.T) {
+	d := loadSmall(t)
+	require.Len(t, d.Entries, 4)
+	assert.Equal(t, Entry{
+		Kanji: []string{"町", "街"},
+		Readings: []Reading{
+			{Text: "まち"},
+			{Text: "ちょう", Restrict: []string{"町"}},
+		},
+		Senses: []Sense{
+			{POS: []string{"n"}, Glosses: []string{"town", "block", "neighbourhood"}},
+			{POS: []string{"n"}, Glosses: []string{"street", "road"}},
+		},
+	}, d.Entries[0])
+	assert.Equal(t, []string{"v1", "vt"}, d.Entries[1].Senses[0].POS)
+}
+
+func TestLookup(t *testing.T) {
+	d := loadSmall(t)
+	tests := []struct {
+		name     string
+		term     string
+		expected []int
+	}{
+		{name: "Kanji", term: "街", expected: []int{0}},
+		{name: "Reading", term: "まち", expected: []int{0}},
+		{name: "Hiragana matches katakana", term: "てれび", expected: []int{2}},
+		{name: "Romaji", term: "taberu", expected: []int{1}},
+		{name: "Unknown term", term: "じんじゃ"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var expected []*Entry
+			for _, i := range test.expected {
+				expected = append(expected, &d.Entries[i])
+			}
+			assert.Equal(t, expected, d.Lookup(test.term))
+		})
+	}
+}
+
+func TestReadingsOf(t *testing.T) {
+	d := loadSmall(t)
+	assert.Equal(t, []string{"まち", "ちょう"}, d.Entries[0].ReadingsOf("町"))
+	assert.Equal(t, []string{"まち"}, d.Entries[0].ReadingsOf("街"))
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	d := loadSmall(t)
+	var b bytes.Buffer
+	require.NoError(t, d.Save(&b))
+	loaded, err := Load(&b)
+	require.NoError(t, err)
+	assert.Equal(t, d.Entries, loaded.Entries)
+	assert.Len(t, loaded.Lookup("まち"), 1)
+}
+
+func TestOpenKeepsIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jmdict")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	xml, err := ioutil.ReadFile(smallPath)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "JMdict_e.xml")
+	require.NoError(t, ioutil.WriteFile(path, xml, 0644))
+
+	d, err := Open(path)
+	require.NoError(t, err)
+	assert.Len(t, d.Entries, 4)
+	require.FileExists(t, IndexPath(path))
+
+	// Once indexed, the XML isn't read again.
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, ioutil.WriteFile(path, []byte("not xml"), 0644))
+	require.NoError(t, os.Chtimes(path, old, old))
+	d, err = Open(path)
+	require.NoError(t, err)
+	assert.Len(t, d.Entries, 4)
+
+	// Unless it changes.
+	require.NoError(t, os.Chtimes(path, time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+	d, err = Open(path)
+	require.NoError(t, err)
+	assert.Empty(t, d.Entries)
+}
+
+func TestOpenWithoutIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jmdict")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	xml, err := ioutil.ReadFile(smallPath)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "JMdict_e.xml")
+	require.NoError(t, ioutil.WriteFile(path, xml, 0644))
+	// A directory in the way of the index can't be replaced, like an index
+	// in a read-only directory.
+	require.NoError(t, os.MkdirAll(filepath.Join(IndexPath(path), "keep"), 0755))
+
+	// The dictionary is still returned when the index can't be saved.
+	d, err := Open(path)
+	_, ok := err.(*IndexError)
+	assert.True(t, ok, "%v", err)
+	require.NotNil(t, d)
+	assert.Len(t, d.Entries, 4)
+
+	_, err = Index(path)
+	assert.Error(t, err)
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
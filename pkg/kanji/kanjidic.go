@@ -0,0 +1,104 @@
+// Package kanji reports on the kanji used in a deck, using a local copy of
+// KANJIDIC2, the free kanji dictionary, to group them.
+package kanji
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/pkg/errors"
+)
+
+// Character is what KANJIDIC2 says about a kanji.
+type Character struct {
+	Literal string
+	// Grade is the school grade the kanji is taught in: 1 to 6 in
+	// elementary school, 8 for the rest of the jōyō kanji, 9 and 10 for
+	// kanji used in names. It's 0 for other kanji.
+	Grade int
+	// Strokes is the accepted stroke count.
+	Strokes int
+	// JLPT is the level of the old JLPT, from 4 (easiest) to 1, or 0 if
+	// the kanji wasn't on it.
+	JLPT        int
+	OnReadings  []string
+	KunReadings []string
+	Meanings    []string
+}
+
+// Dictionary maps kanji to what KANJIDIC2 says about them.
+type Dictionary map[string]*Character
+
+// xmlCharacter is a character as it's written in KANJIDIC2's XML.
+type xmlCharacter struct {
+	Literal string `xml:"literal"`
+	Grade   int    `xml:"misc>grade"`
+	// The first stroke count is the accepted one; others are common mistakes.
+	Strokes  []int `xml:"misc>stroke_count"`
+	JLPT     int   `xml:"misc>jlpt"`
+	Readings []struct {
+		Text string `xml:",chardata"`
+		Type string `xml:"r_type,attr"`
+	} `xml:"reading_meaning>rmgroup>reading"`
+	Meanings []struct {
+		Text string `xml:",chardata"`
+		Lang string `xml:"m_lang,attr"`
+	} `xml:"reading_meaning>rmgroup>meaning"`
+}
+
+// ParseDictionary reads KANJIDIC2's XML, keeping English meanings only.
+func ParseDictionary(r io.Reader) (Dictionary, error) {
+	decoder := xml.NewDecoder(r)
+	d := make(Dictionary)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return d, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading KANJIDIC2")
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "character" {
+			continue
+		}
+		var x xmlCharacter
+		if err := decoder.DecodeElement(&x, &start); err != nil {
+			return nil, errors.Wrap(err, "Error reading KANJIDIC2")
+		}
+		d[x.Literal] = x.character()
+	}
+}
+
+// character converts a character from XML.
+func (x *xmlCharacter) character() *Character {
+	c := &Character{Literal: x.Literal, Grade: x.Grade, JLPT: x.JLPT}
+	if len(x.Strokes) > 0 {
+		c.Strokes = x.Strokes[0]
+	}
+	for _, r := range x.Readings {
+		switch r.Type {
+		case "ja_on":
+			c.OnReadings = append(c.OnReadings, r.Text)
+		case "ja_kun":
+			c.KunReadings = append(c.KunReadings, r.Text)
+		}
+	}
+	for _, m := range x.Meanings {
+		if m.Lang == "" {
+			c.Meanings = append(c.Meanings, m.Text)
+		}
+	}
+	return c
+}
+
+// LoadDictionary loads KANJIDIC2 from a file, which may be compressed.
+func LoadDictionary(path string) (Dictionary, error) {
+	rc, err := file.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't open KANJIDIC2")
+	}
+	defer rc.Close()
+	return ParseDictionary(rc)
+}
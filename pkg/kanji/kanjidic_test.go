@@ -0,0 +1,32 @@
+package kanji
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadSmall(t *testing.T) Dictionary {
+	d, err := LoadDictionary(filepath.Join("testdata", "kanjidic2_small.xml"))
+	require.NoError(t, err)
+	return d
+}
+
+func TestLoadDictionary(t *testing.T) {
+	d := loadSmall(t)
+	assert.Len(t, d, 4)
+	assert.Equal(t, &Character{
+		Literal:     "町",
+		Grade:       1,
+		Strokes:     7,
+		JLPT:        3,
+		OnReadings:  []string{"チョウ"},
+		KunReadings: []string{"まち"},
+		Meanings:    []string{"town", "village"},
+	}, d["町"])
+	// The first stroke count is the accepted one.
+	assert.Equal(t, 4, d["中"].Strokes)
+	assert.Equal(t, &Character{Literal: "噌", Strokes: 15}, d["噌"])
+}
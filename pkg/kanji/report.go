@@ -0,0 +1,228 @@
+package kanji
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/script"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Usage is a kanji used in a deck.
+type Usage struct {
+	Kanji string
+	// Count is the number of times the kanji is used, counting each use
+	// within an entry.
+	Count int
+	// Entries are the entries using the kanji, in deck order.
+	Entries []*types.Entry
+	// Info is what KANJIDIC2 says about the kanji, or nil if it isn't there.
+	Info *Character
+}
+
+// Extract returns the kanji used in the Japanese of entries, most used
+// first, then in the order they first appear.
+func Extract(entries []*types.Entry, d Dictionary) []*Usage {
+	byKanji := make(map[string]*Usage)
+	var usages []*Usage
+	for _, e := range entries {
+		for _, r := range e.Japanese {
+			// The iteration mark 々 repeats a kanji rather than being one.
+			if script.Of(r) != script.Kanji || r == '々' {
+				continue
+			}
+			k := string(r)
+			u, ok := byKanji[k]
+			if !ok {
+				u = &Usage{Kanji: k, Info: d[k]}
+				byKanji[k] = u
+				usages = append(usages, u)
+			}
+			u.Count++
+			if len(u.Entries) == 0 || u.Entries[len(u.Entries)-1] != e {
+				u.Entries = append(u.Entries, e)
+			}
+		}
+	}
+	sort.SliceStable(usages, func(i, j int) bool { return usages[i].Count > usages[j].Count })
+	return usages
+}
+
+// GroupBy is a way of grouping kanji.
+type GroupBy int
+
+const (
+	// ByGrade groups kanji by the school grade they're taught in.
+	ByGrade GroupBy = iota
+	// ByJLPT groups kanji by their level of the old JLPT.
+	ByJLPT
+	// ByStrokes groups kanji by their stroke count.
+	ByStrokes
+)
+
+var groupByNames = map[GroupBy]string{
+	ByGrade:   "grade",
+	ByJLPT:    "jlpt",
+	ByStrokes: "strokes",
+}
+
+func (g GroupBy) String() string {
+	return groupByNames[g]
+}
+
+// ParseGroupBy returns the GroupBy with a name, such as grade.
+func ParseGroupBy(name string) (GroupBy, error) {
+	for g, n := range groupByNames {
+		if n == name {
+			return g, nil
+		}
+	}
+	return 0, errors.Errorf("Unknown grouping %s, expected grade, jlpt or strokes", name)
+}
+
+// unknownGroup sorts groups of kanji not in KANJIDIC2 last.
+const unknownGroup = 1000
+
+// group returns the name of the group of a kanji, and a key to order the
+// groups by.
+func (g GroupBy) group(u *Usage) (int, string) {
+	c := u.Info
+	if c == nil {
+		return unknownGroup, "Not in KANJIDIC2"
+	}
+	switch g {
+	case ByGrade:
+		switch {
+		case c.Grade >= 1 && c.Grade <= 6:
+			return c.Grade, fmt.Sprintf("Grade %d", c.Grade)
+		case c.Grade == 8:
+			return c.Grade, "Secondary school"
+		case c.Grade == 9 || c.Grade == 10:
+			return 9, "Names (jinmeiyō)"
+		}
+		return unknownGroup - 1, "Ungraded"
+	case ByJLPT:
+		if c.JLPT == 0 {
+			return unknownGroup - 1, "Not on the JLPT"
+		}
+		// Easiest level first.
+		return -c.JLPT, fmt.Sprintf("JLPT %d", c.JLPT)
+	}
+	if c.Strokes == 1 {
+		return 1, "1 stroke"
+	}
+	return c.Strokes, fmt.Sprintf("%d strokes", c.Strokes)
+}
+
+// Group is kanji grouped together, such as those of a school grade.
+type Group struct {
+	Name  string
+	Kanji []*Usage
+}
+
+// Groups groups kanji, keeping their order within each group.
+func Groups(usages []*Usage, by GroupBy) []Group {
+	keys := make(map[string]int)
+	byName := make(map[string]*Group)
+	var names []string
+	for _, u := range usages {
+		key, name := by.group(u)
+		g, ok := byName[name]
+		if !ok {
+			g = &Group{Name: name}
+			byName[name] = g
+			keys[name] = key
+			names = append(names, name)
+		}
+		g.Kanji = append(g.Kanji, u)
+	}
+	sort.Slice(names, func(i, j int) bool { return keys[names[i]] < keys[names[j]] })
+	groups := make([]Group, len(names))
+	for i, name := range names {
+		groups[i] = *byName[name]
+	}
+	return groups
+}
+
+// number formats a number that's 0 when unknown.
+func number(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// entryList lists entries by their Japanese and English.
+func entryList(entries []*types.Entry) []string {
+	list := make([]string, len(entries))
+	for i, e := range entries {
+		list[i] = fmt.Sprintf("%s (%s)", e.Japanese, e.English)
+	}
+	return list
+}
+
+// WriteCSV writes groups of kanji as CSV, with a header and a row per kanji.
+func WriteCSV(w io.Writer, groups []Group) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"group", "kanji", "count", "grade", "jlpt", "strokes", "on", "kun", "meanings", "entries"})
+	for _, g := range groups {
+		for _, u := range g.Kanji {
+			c := u.Info
+			if c == nil {
+				c = &Character{}
+			}
+			writer.Write([]string{
+				g.Name,
+				u.Kanji,
+				strconv.Itoa(u.Count),
+				number(c.Grade),
+				number(c.JLPT),
+				number(c.Strokes),
+				strings.Join(c.OnReadings, " "),
+				strings.Join(c.KunReadings, " "),
+				strings.Join(c.Meanings, "; "),
+				strings.Join(entryList(u.Entries), "; "),
+			})
+		}
+	}
+	writer.Flush()
+	return errors.Wrap(writer.Error(), "Error writing kanji report")
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join":    strings.Join,
+	"number":  number,
+	"entries": entryList,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Kanji</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.5em; text-align: left; vertical-align: top; }
+td.kanji { font-size: 2em; }
+</style>
+</head>
+<body>
+<h1>Kanji</h1>
+{{range .}}<h2>{{.Name}} ({{len .Kanji}})</h2>
+<table>
+<tr><th>Kanji</th><th>Uses</th><th>Grade</th><th>JLPT</th><th>Strokes</th><th>Readings</th><th>Meanings</th><th>Entries</th></tr>
+{{range .Kanji}}<tr><td class="kanji">{{.Kanji}}</td><td>{{.Count}}</td>{{with .Info}}<td>{{number .Grade}}</td><td>{{number .JLPT}}</td><td>{{number .Strokes}}</td><td>{{join .OnReadings "、"}}<br>{{join .KunReadings "、"}}</td><td>{{join .Meanings ", "}}</td>{{else}}<td></td><td></td><td></td><td></td><td></td>{{end}}<td>{{range $i, $e := entries .Entries}}{{if $i}}<br>{{end}}{{$e}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes groups of kanji as an HTML page, with a table per group.
+func WriteHTML(w io.Writer, groups []Group) error {
+	return errors.Wrap(htmlReport.Execute(w, groups), "Error writing kanji report")
+}
@@ -0,0 +1,127 @@
+package kanji
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deck() []*types.Entry {
+	return []*types.Entry{
+		types.NewEntry("町", "town", "1"),
+		types.NewEntry("食べる", "to eat", "2"),
+		types.NewEntry("町中", "in town", "3"),
+		types.NewEntry("中々", "quite", "4"),
+		types.NewEntry("味噌", "miso", "5"),
+		types.NewEntry("まち", "town", "6"),
+	}
+}
+
+func kanjiOf(usages []*Usage) []string {
+	var kanji []string
+	for _, u := range usages {
+		kanji = append(kanji, u.Kanji)
+	}
+	return kanji
+}
+
+func TestExtract(t *testing.T) {
+	d := loadSmall(t)
+	entries := deck()
+	usages := Extract(entries, d)
+	assert.Equal(t, []string{"町", "中", "食", "味", "噌"}, kanjiOf(usages))
+	assert.Equal(t, 2, usages[0].Count)
+	assert.Equal(t, []*types.Entry{entries[0], entries[2]}, usages[0].Entries)
+	assert.Equal(t, d["町"], usages[0].Info)
+	assert.Nil(t, usages[3].Info)
+}
+
+func TestGroups(t *testing.T) {
+	d := loadSmall(t)
+	usages := Extract(deck(), d)
+	tests := []struct {
+		by       GroupBy
+		expected map[string][]string
+		order    []string
+	}{
+		{
+			by:    ByGrade,
+			order: []string{"Grade 1", "Grade 2", "Ungraded", "Not in KANJIDIC2"},
+			expected: map[string][]string{
+				"Grade 1":          {"町", "中"},
+				"Grade 2":          {"食"},
+				"Ungraded":         {"噌"},
+				"Not in KANJIDIC2": {"味"},
+			},
+		},
+		{
+			by:    ByJLPT,
+			order: []string{"JLPT 4", "JLPT 3", "Not on the JLPT", "Not in KANJIDIC2"},
+			expected: map[string][]string{
+				"JLPT 4":           {"中", "食"},
+				"JLPT 3":           {"町"},
+				"Not on the JLPT":  {"噌"},
+				"Not in KANJIDIC2": {"味"},
+			},
+		},
+		{
+			by:    ByStrokes,
+			order: []string{"4 strokes", "7 strokes", "9 strokes", "15 strokes", "Not in KANJIDIC2"},
+			expected: map[string][]string{
+				"4 strokes":        {"中"},
+				"7 strokes":        {"町"},
+				"9 strokes":        {"食"},
+				"15 strokes":       {"噌"},
+				"Not in KANJIDIC2": {"味"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.by.String(), func(t *testing.T) {
+			groups := Groups(usages, test.by)
+			var order []string
+			for _, g := range groups {
+				order = append(order, g.Name)
+				assert.Equal(t, test.expected[g.Name], kanjiOf(g.Kanji), g.Name)
+			}
+			assert.Equal(t, test.order, order)
+		})
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	by, err := ParseGroupBy("jlpt")
+	require.NoError(t, err)
+	assert.Equal(t, ByJLPT, by)
+	_, err = ParseGroupBy("radical")
+	assert.Error(t, err)
+}
+
+func TestWriteCSV(t *testing.T) {
+	entries := []*types.Entry{types.NewEntry("町", "town", "1"), types.NewEntry("味噌", "miso, the paste", "2")}
+	groups := Groups(Extract(entries, loadSmall(t)), ByGrade)
+
+	var b strings.Builder
+	require.NoError(t, WriteCSV(&b, groups))
+	assert.Equal(t, `group,kanji,count,grade,jlpt,strokes,on,kun,meanings,entries
+Grade 1,町,1,1,3,7,チョウ,まち,town; village,町 (town)
+Ungraded,噌,1,,,15,,,,"味噌 (miso, the paste)"
+Not in KANJIDIC2,味,1,,,,,,,"味噌 (miso, the paste)"
+`, b.String())
+}
+
+func TestWriteHTML(t *testing.T) {
+	entries := []*types.Entry{types.NewEntry("町", "town", "1"), types.NewEntry("町<b>", "<town>", "2")}
+	groups := Groups(Extract(entries, loadSmall(t)), ByGrade)
+
+	var b strings.Builder
+	require.NoError(t, WriteHTML(&b, groups))
+	html := b.String()
+	assert.Contains(t, html, "<h2>Grade 1 (1)</h2>")
+	assert.Contains(t, html, `<td class="kanji">町</td><td>2</td><td>1</td><td>3</td><td>7</td>`)
+	assert.Contains(t, html, "町 (town)<br>町&lt;b&gt; (&lt;town&gt;)")
+}
@@ -0,0 +1,452 @@
+// Package lint checks decks for common mistakes, like English in the
+// Japanese column, and fixes those that can be fixed safely.
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/schema"
+	"github.com/nrb/csvmerger/pkg/script"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// ParseErrorRule is the ID of findings for lines that aren't valid entries.
+const ParseErrorRule = "parse-error"
+
+// SwappedColumnsRule is the ID of findings for lines whose Japanese and
+// English columns look swapped.
+const SwappedColumnsRule = "swapped-columns"
+
+// Severity is how serious a finding is.
+type Severity int
+
+const (
+	// Off turns a rule off.
+	Off Severity = iota
+	Info
+	Warning
+	Error
+)
+
+var severityNames = map[Severity]string{
+	Off:     "off",
+	Info:    "info",
+	Warning: "warning",
+	Error:   "error",
+}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+// Level returns the diagnostic level of a severity.
+func (s Severity) Level() diagnostic.Level {
+	switch s {
+	case Error:
+		return diagnostic.Error
+	case Warning:
+		return diagnostic.Warning
+	}
+	return diagnostic.Note
+}
+
+// ParseSeverity returns the Severity with a name, such as warning.
+func ParseSeverity(name string) (Severity, error) {
+	for s, n := range severityNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return Off, errors.Errorf("Unknown severity %s, expected off, info, warning or error", name)
+}
+
+// Finding is a problem found on a line of a deck.
+type Finding struct {
+	File     string
+	Line     int
+	Rule     string
+	Severity Severity
+	Message  string
+	// Fixable is set if Fix can fix the problem.
+	Fixable bool
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s (%s)", f.File, f.Line, f.Severity, f.Message, f.Rule)
+}
+
+// Diagnostic returns the finding as a diagnostic.Diagnostic.
+func (f Finding) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Location: diagnostic.Location{File: f.File, Line: f.Line},
+		Rule:     f.Rule,
+		Level:    f.Severity.Level(),
+		Message:  f.Message,
+	}
+}
+
+// DiagnosticRules describes every rule findings may come from, including
+// parse errors and the tag schema rules.
+func DiagnosticRules() []diagnostic.Rule {
+	rules := []diagnostic.Rule{{ID: ParseErrorRule, Description: "a line isn't a valid entry"}}
+	for _, r := range Rules {
+		rules = append(rules, diagnostic.Rule{ID: r.ID, Description: r.Description})
+	}
+	for _, id := range []string{schema.UnknownTagRule, schema.RequiredRule, schema.ExclusiveRule} {
+		rules = append(rules, diagnostic.Rule{ID: id, Description: schema.RuleDescriptions[id]})
+	}
+	return rules
+}
+
+// Line is an entry of a deck, along with the line it was read from.
+type Line struct {
+	*types.Entry
+	Line int
+	// fixed is set once a fix has changed the entry, so Write rewrites it.
+	fixed bool
+}
+
+// File is a deck being linted.
+type File struct {
+	Path string
+	// Sep is the field separator of the file.
+	Sep   string
+	Lines []*Line
+	// ParseErrors are the lines that couldn't be read as entries.
+	ParseErrors []*file.ParseError
+
+	// text holds every line as it was read, with its line ending, so Write
+	// can leave the lines that weren't fixed exactly as they were.
+	text []string
+	// removed holds the numbers of the lines removed by fixes.
+	removed map[int]bool
+	// matcher decides which lines are duplicates, for first.
+	matcher types.Matcher
+	first   map[string]*Line
+	// reversed is set if most lines have their columns swapped.
+	reversed bool
+}
+
+// Load reads a deck to lint. Lines that aren't valid entries are recorded
+// in ParseErrors, instead of stopping the load. If sources is set, lines
+// may have a fourth field holding their entry's sources.
+func Load(path string, sources bool) (*File, error) {
+	rc, err := file.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error with file %s", path)
+	}
+	defer rc.Close()
+	return Read(rc, path, file.Separator(path), sources)
+}
+
+// Read reads a deck to lint from r, with fields split by sep, like Load.
+func Read(r io.Reader, path, sep string, sources bool) (*File, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error with file %s", path)
+	}
+	f := &File{Path: file.SourceName(path), Sep: sep, text: splitLines(string(data)), removed: make(map[int]bool)}
+	reader := file.NewReader(bytes.NewReader(data), sep, "")
+	reader.Sources = sources
+	for {
+		e, err := reader.Next()
+		if err == io.EOF {
+			return f, nil
+		}
+		if perr, ok := err.(*file.ParseError); ok {
+			f.ParseErrors = append(f.ParseErrors, perr)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error with file %s", path)
+		}
+		f.Lines = append(f.Lines, &Line{Entry: e, Line: reader.Line()})
+	}
+}
+
+// First returns the first line of the file whose entry is equal to l's,
+// which is l itself unless l is a duplicate.
+func (f *File) First(l *Line) *Line {
+	return f.first[f.matcher.Key(l.Entry)]
+}
+
+// Reversed reports whether the whole file looks like it was written with
+// its columns the wrong way round.
+func (f *File) Reversed() bool {
+	return f.reversed
+}
+
+// index records the first line of each entry matching according to m, for
+// First, and whether the file looks reversed.
+func (f *File) index(m types.Matcher) {
+	f.matcher = m
+	f.first = make(map[string]*Line)
+	var counter script.ReversalCounter
+	for _, l := range f.Lines {
+		key := m.Key(l.Entry)
+		if _, ok := f.first[key]; !ok {
+			f.first[key] = l
+		}
+		counter.Add(l.Japanese, l.English)
+	}
+	f.reversed = counter.Reversed()
+}
+
+// splitLines splits text into lines, keeping their line endings.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Write writes the file to w. Lines changed by fixes are written with tags
+// in order, those removed by fixes are left out, and every other line,
+// including blank lines and lines that couldn't be parsed, is written
+// exactly as it was read.
+func (f *File) Write(w io.Writer, order types.TagOrder) error {
+	fixed := make(map[int]*Line)
+	for _, l := range f.Lines {
+		if l.fixed {
+			fixed[l.Line] = l
+		}
+	}
+	bw := bufio.NewWriter(w)
+	for i, text := range f.text {
+		if f.removed[i+1] {
+			continue
+		}
+		if l, ok := fixed[i+1]; ok {
+			ending := text[len(strings.TrimRight(text, "\r\n")):]
+			text = l.format(f.Sep, order) + ending
+		}
+		if _, err := bw.WriteString(text); err != nil {
+			return errors.Wrap(err, "Error writing entries")
+		}
+	}
+	return errors.Wrap(bw.Flush(), "Error writing entries")
+}
+
+// format returns the line as written by a file.Writer, with tags in order
+// and its sources if it was read with them.
+func (l *Line) format(sep string, order types.TagOrder) string {
+	var b strings.Builder
+	writer := file.NewWriter(&b, sep)
+	writer.TagOrder = order
+	writer.Sources = l.Sources != nil
+	// Writing to a strings.Builder can't fail.
+	writer.Write(l.Entry)
+	writer.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Rule checks the lines of a deck for one kind of problem.
+type Rule struct {
+	ID          string
+	Description string
+	// Severity is the rule's severity unless a Config says otherwise.
+	Severity Severity
+	// Check returns a message for each problem with a line.
+	Check func(f *File, l *Line) []string
+	// Fix fixes the problems Check finds with a line, and returns false
+	// if the line should be removed. Rules that can't be fixed safely
+	// don't have a Fix.
+	Fix func(f *File, l *Line) bool
+	// CanFix, if set, reports whether Fix can fix the problems with a
+	// line. Without it, Fix can fix every problem Check finds.
+	CanFix func(f *File, l *Line) bool
+}
+
+// fixable reports whether the rule can fix the problems with a line.
+func (r Rule) fixable(f *File, l *Line) bool {
+	return r.Fix != nil && (r.CanFix == nil || r.CanFix(f, l))
+}
+
+// Linter checks decks against a set of rules.
+type Linter struct {
+	Rules  []Rule
+	Config Config
+	// Schema, if set, checks the tags of each entry as well.
+	Schema *schema.Schema
+}
+
+// New returns a Linter with the built-in rules, at the severities of config.
+func New(config Config) *Linter {
+	return &Linter{Rules: Rules, Config: config}
+}
+
+// matcher returns the Matcher deciding which lines are duplicates.
+func (l *Linter) matcher() types.Matcher {
+	if l.Config.Matcher == nil {
+		return types.ExactMatcher
+	}
+	return l.Config.Matcher
+}
+
+// severity returns the severity of a rule, or def if the Config doesn't set one.
+func (l *Linter) severity(id string, def Severity) Severity {
+	if s, ok := l.Config.Severities[id]; ok {
+		return s
+	}
+	return def
+}
+
+// Check returns the findings for a file, ordered by line.
+func (l *Linter) Check(f *File) []Finding {
+	var findings []Finding
+	if sev := l.severity(ParseErrorRule, Error); sev != Off {
+		for _, perr := range f.ParseErrors {
+			findings = append(findings, Finding{
+				File: f.Path, Line: perr.Line, Rule: ParseErrorRule, Severity: sev, Message: perr.Err.Error(),
+			})
+		}
+	}
+
+	f.index(l.matcher())
+	for _, r := range l.Rules {
+		sev := l.severity(r.ID, r.Severity)
+		if sev == Off {
+			continue
+		}
+		for _, line := range f.Lines {
+			for _, msg := range r.Check(f, line) {
+				findings = append(findings, Finding{
+					File: f.Path, Line: line.Line, Rule: r.ID, Severity: sev, Message: msg, Fixable: r.fixable(f, line),
+				})
+			}
+		}
+	}
+
+	if l.Schema != nil {
+		for _, line := range f.Lines {
+			for _, v := range l.Schema.Validate(line.Entry) {
+				sev := l.severity(v.Rule, Error)
+				if sev == Off {
+					continue
+				}
+				findings = append(findings, Finding{
+					File: f.Path, Line: line.Line, Rule: v.Rule, Severity: sev, Message: v.Message,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+// Fix fixes the problems found by the rules that can be fixed safely and
+// aren't turned off, and returns the number of lines changed or removed.
+// Rules are applied in order, so the fixes of one rule are seen by the next.
+func (l *Linter) Fix(f *File) int {
+	changed := make(map[*Line]bool)
+	for _, r := range l.Rules {
+		if r.Fix == nil || l.severity(r.ID, r.Severity) == Off {
+			continue
+		}
+		f.index(l.matcher())
+		var kept []*Line
+		for _, line := range f.Lines {
+			if len(r.Check(f, line)) > 0 && r.fixable(f, line) {
+				changed[line] = true
+				if !r.Fix(f, line) {
+					f.removed[line.Line] = true
+					continue
+				}
+				line.fixed = true
+			}
+			kept = append(kept, line)
+		}
+		f.Lines = kept
+	}
+	return len(changed)
+}
+
+// Config configures a Linter.
+type Config struct {
+	// Severities sets the severity of rules by their ID. Rules it doesn't
+	// mention keep their default severity.
+	Severities map[string]Severity
+	// Matcher, if set, decides which lines are duplicates of each other.
+	// The ExactMatcher is used if it's nil.
+	Matcher types.Matcher
+}
+
+// LoadConfig loads a Config from a file. See ParseConfig for the format.
+func LoadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "Couldn't open lint config")
+	}
+	defer f.Close()
+	return ParseConfig(f)
+}
+
+// ParseConfig parses a Config, with a rule ID and its severity per line:
+//
+//	empty-tags     off
+//	doubled-spaces error
+//	match          japanese
+//
+// Anything after a # is a comment. The IDs of tag schema rules, like
+// unknown-tag, can be given as well. A match line names the matcher
+// deciding which lines are duplicates, as the -match flag does.
+func ParseConfig(r io.Reader) (Config, error) {
+	config := Config{Severities: make(map[string]Severity)}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return Config{}, errors.Errorf("Line %d: expected a rule and a severity", line)
+		}
+		if fields[0] == "match" {
+			m, err := types.ParseMatcher(fields[1])
+			if err != nil {
+				return Config{}, errors.Wrapf(err, "Line %d", line)
+			}
+			config.Matcher = m
+			continue
+		}
+		if !knownRule(fields[0]) {
+			return Config{}, errors.Errorf("Line %d: unknown rule %s", line, fields[0])
+		}
+		sev, err := ParseSeverity(fields[1])
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "Line %d", line)
+		}
+		config.Severities[fields[0]] = sev
+	}
+	if err := scanner.Err(); err != nil {
+		return Config{}, errors.Wrap(err, "Error reading lint config")
+	}
+	return config, nil
+}
+
+func knownRule(id string) bool {
+	for _, r := range DiagnosticRules() {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
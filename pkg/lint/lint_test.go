@@ -0,0 +1,169 @@
+package lint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/schema"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func read(t *testing.T, deck string) *File {
+	f, err := Read(strings.NewReader(deck), "deck.csv", ",", false)
+	require.NoError(t, err)
+	return f
+}
+
+func TestCheck(t *testing.T) {
+	f := read(t, strings.Join([]string{
+		"まち,city / town,1",
+		"まち,city / town",
+		"to eat,たべる,2",
+		"まち,city / town,3",
+	}, "\n"))
+	findings := New(Config{}).Check(f)
+	assert.Equal(t, []Finding{
+		{File: "deck.csv", Line: 2, Rule: ParseErrorRule, Severity: Error, Message: "Expected 3 fields, got 2 for まち,city / town"},
+		{File: "deck.csv", Line: 3, Rule: "swapped-columns", Severity: Error, Message: "Columns of to eat,たべる look swapped"},
+		{File: "deck.csv", Line: 4, Rule: "duplicate-line", Severity: Warning, Message: "Duplicate of line 1", Fixable: true},
+	}, findings)
+}
+
+func TestCheckUsesConfig(t *testing.T) {
+	f := read(t, "まち,city / town,\nまち,city / town,1")
+	config := Config{Severities: map[string]Severity{"empty-tags": Error, "duplicate-line": Off}}
+	findings := New(config).Check(f)
+	assert.Equal(t, []Finding{
+		{File: "deck.csv", Line: 1, Rule: "empty-tags", Severity: Error, Message: "Entry has no tags"},
+	}, findings)
+}
+
+func TestConfigMatcher(t *testing.T) {
+	l := New(Config{Matcher: types.JapaneseMatcher})
+	f := read(t, "まち,town,1\nまち,city,2\n")
+	assert.Equal(t, []Finding{
+		{File: "deck.csv", Line: 2, Rule: "duplicate-line", Severity: Warning, Message: "Duplicate of line 1", Fixable: true},
+	}, l.Check(f))
+
+	assert.Equal(t, 1, l.Fix(f))
+	var buf bytes.Buffer
+	require.NoError(t, f.Write(&buf, types.NaturalOrder))
+	assert.Equal(t, "まち,city / town,1 2\n", buf.String())
+
+	// Other linters don't share the matcher.
+	assert.Empty(t, New(Config{}).Check(read(t, "まち,town,1\nまち,city,2\n")))
+}
+
+func TestCheckSchema(t *testing.T) {
+	s, err := schema.Parse(strings.NewReader("require lesson lesson::*"))
+	require.NoError(t, err)
+	l := New(Config{})
+	l.Schema = s
+	findings := l.Check(read(t, "まち,city / town,noun"))
+	require.Len(t, findings, 1)
+	assert.Equal(t, schema.RequiredRule, findings[0].Rule)
+	assert.Equal(t, 1, findings[0].Line)
+}
+
+func TestFix(t *testing.T) {
+	f := read(t, strings.Join([]string{
+		` まち , city / town ,1`,
+		`まち,city / town,2`,
+		``,
+		`たべる,"to eat",3`,
+		`はい、どうぞ,"yes, please",4`,
+		`いいえ,no  thanks;no,5`,
+		`いぬ,dog,b a`,
+		`くつ,big "red" shoes,6`,
+		`not an entry`,
+		`ねこ,cat,c`,
+	}, "\r\n"))
+	l := New(Config{})
+	assert.Equal(t, 4, l.Fix(f))
+
+	var buf bytes.Buffer
+	require.NoError(t, f.Write(&buf, types.NaturalOrder))
+	assert.Equal(t, strings.Join([]string{
+		`まち,city / town,1 2`,
+		``,
+		`たべる,to eat,3`,
+		`はい、どうぞ,"yes, please",4`,
+		`いいえ,no thanks;no,5`,
+		`いぬ,dog,b a`,
+		`くつ,big "red" shoes,6`,
+		`not an entry`,
+		`ねこ,cat,c`,
+	}, "\r\n"), buf.String())
+
+	// Gloss separators and quotes within a field are reported, but not fixed.
+	findings := l.Check(f)
+	require.Len(t, findings, 3)
+	assert.Equal(t, "gloss-separator", findings[0].Rule)
+	assert.False(t, findings[0].Fixable)
+	assert.Equal(t, "stray-quotes", findings[1].Rule)
+	assert.False(t, findings[1].Fixable)
+	assert.Equal(t, ParseErrorRule, findings[2].Rule)
+}
+
+func TestFixReversedFile(t *testing.T) {
+	l := New(Config{})
+
+	// A single swapped line isn't fixed, since it might be a mistake of another kind.
+	f := read(t, "まち,city / town,1\nto eat,たべる,2\nいぬ,dog,3")
+	assert.False(t, f.Reversed())
+	assert.Equal(t, 0, l.Fix(f))
+
+	// Nor are the lines of a file too small to tell whether it's reversed.
+	f = read(t, "city / town,まち,1\nto eat,たべる,2\nCD,CD,3")
+	assert.False(t, f.Reversed())
+	assert.Equal(t, 0, l.Fix(f))
+
+	f = read(t, "city / town,まち,1\nto eat,たべる,2\nCD,CD,3\nto drink,のむ,4\nhouse,いえ,5\ndog,いぬ,6")
+	for _, finding := range l.Check(f) {
+		if finding.Rule == SwappedColumnsRule {
+			assert.True(t, finding.Fixable)
+		}
+	}
+	assert.Equal(t, 5, l.Fix(f))
+	var buf bytes.Buffer
+	require.NoError(t, f.Write(&buf, types.NaturalOrder))
+	assert.Equal(t, "まち,city / town,1\nたべる,to eat,2\nCD,CD,3\nのむ,to drink,4\nいえ,house,5\nいぬ,dog,6", buf.String())
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(`
+# Contributed decks don't have tags yet
+empty-tags   off
+whitespace   error  # always trim
+unknown-tag  warning
+match        japanese
+`))
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		Severities: map[string]Severity{"empty-tags": Off, "whitespace": Error, "unknown-tag": Warning},
+		Matcher:    types.JapaneseMatcher,
+	}, config)
+
+	_, err = ParseConfig(strings.NewReader("no-such-rule error"))
+	assert.Error(t, err)
+	_, err = ParseConfig(strings.NewReader("whitespace loud"))
+	assert.Error(t, err)
+	_, err = ParseConfig(strings.NewReader("whitespace"))
+	assert.Error(t, err)
+	_, err = ParseConfig(strings.NewReader("match loosely"))
+	assert.Error(t, err)
+}
+
+func TestFindingDiagnostic(t *testing.T) {
+	f := Finding{File: "deck.csv", Line: 3, Rule: "empty-tags", Severity: Info, Message: "Entry has no tags"}
+	assert.Equal(t, diagnostic.Diagnostic{
+		Location: diagnostic.Location{File: "deck.csv", Line: 3},
+		Rule:     "empty-tags",
+		Level:    diagnostic.Note,
+		Message:  "Entry has no tags",
+	}, f.Diagnostic())
+}
@@ -0,0 +1,275 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/script"
+)
+
+// Rules are the built-in rules, in the order they're checked and fixed.
+var Rules = []Rule{
+	{
+		ID:          SwappedColumnsRule,
+		Description: "the Japanese and English columns look swapped; fixing swaps them back if the whole file looks reversed",
+		Severity:    Error,
+		Check:       checkSwappedColumns,
+		Fix:         fixSwappedColumns,
+		CanFix:      canFixSwappedColumns,
+	},
+	{
+		ID:          "english-in-japanese",
+		Description: "the Japanese column is mostly latin letters",
+		Severity:    Error,
+		Check:       checkEnglishInJapanese,
+	},
+	{
+		ID:          "japanese-in-english",
+		Description: "the English column contains kana or kanji",
+		Severity:    Error,
+		Check:       checkJapaneseInEnglish,
+	},
+	{
+		ID:          "no-japanese-script",
+		Description: "the Japanese column has no kana or kanji",
+		Severity:    Warning,
+		Check:       checkNoJapaneseScript,
+	},
+	{
+		ID:          "empty-field",
+		Description: "the Japanese or English column is empty",
+		Severity:    Error,
+		Check:       checkEmptyField,
+	},
+	{
+		ID:          "stray-quotes",
+		Description: "quotes that don't surround a field containing the separator",
+		Severity:    Warning,
+		Check:       checkStrayQuotes,
+		Fix:         fixStrayQuotes,
+		CanFix:      canFixStrayQuotes,
+	},
+	{
+		ID:          "gloss-separator",
+		Description: "glosses not separated by \" / \"",
+		Severity:    Info,
+		Check:       checkGlossSeparator,
+	},
+	{
+		ID:          "whitespace",
+		Description: "leading or trailing whitespace in the Japanese or English column",
+		Severity:    Warning,
+		Check:       checkWhitespace,
+		Fix:         fixWhitespace,
+	},
+	{
+		ID:          "doubled-spaces",
+		Description: "several spaces in a row in the Japanese or English column",
+		Severity:    Warning,
+		Check:       checkDoubledSpaces,
+		Fix:         fixDoubledSpaces,
+	},
+	{
+		ID:          "empty-tags",
+		Description: "the entry has no tags",
+		Severity:    Warning,
+		Check:       checkEmptyTags,
+	},
+	{
+		ID:          "duplicate-line",
+		Description: "the entry is repeated within the file; fixing merges the tags into the first line",
+		Severity:    Warning,
+		Check:       checkDuplicateLine,
+		Fix:         fixDuplicateLine,
+	},
+}
+
+// field is a column of a line, by name.
+type field struct {
+	name  string
+	value *string
+}
+
+// fields returns the columns of a line checked by the field rules.
+func fields(l *Line) []field {
+	return []field{{"Japanese", &l.Japanese}, {"English", &l.English}}
+}
+
+func checkSwappedColumns(f *File, l *Line) []string {
+	if !script.Swapped(l.Japanese, l.English) {
+		return nil
+	}
+	if f.Reversed() {
+		return []string{fmt.Sprintf("Columns of %s,%s look swapped, like most of the file", l.Japanese, l.English)}
+	}
+	return []string{fmt.Sprintf("Columns of %s,%s look swapped", l.Japanese, l.English)}
+}
+
+// canFixSwappedColumns only lets swapped lines be fixed when the whole file
+// looks reversed; a few swapped lines may be mistakes of another kind.
+func canFixSwappedColumns(f *File, l *Line) bool {
+	return f.Reversed()
+}
+
+func fixSwappedColumns(f *File, l *Line) bool {
+	l.SwapFields()
+	return true
+}
+
+// looksEnglish reports whether Japanese text is mostly latin letters. A few
+// are fine, as in Tシャツ or CDプレーヤー.
+func looksEnglish(japanese string) bool {
+	counts := script.Count(japanese)
+	kana := counts[script.Kanji] + counts[script.Hiragana] + counts[script.Katakana]
+	return counts[script.Latin] > 1 && counts[script.Latin] >= kana
+}
+
+func checkEnglishInJapanese(f *File, l *Line) []string {
+	// Swapped columns are reported by swapped-columns instead.
+	if looksEnglish(l.Japanese) && !script.Swapped(l.Japanese, l.English) {
+		return []string{fmt.Sprintf("Japanese %q looks like English", l.Japanese)}
+	}
+	return nil
+}
+
+func checkNoJapaneseScript(f *File, l *Line) []string {
+	// Text reported by other rules isn't reported again.
+	if strings.TrimSpace(l.Japanese) == "" || script.HasJapanese(l.Japanese) ||
+		looksEnglish(l.Japanese) || script.Swapped(l.Japanese, l.English) {
+		return nil
+	}
+	return []string{fmt.Sprintf("Japanese %q has no kana or kanji", l.Japanese)}
+}
+
+func checkJapaneseInEnglish(f *File, l *Line) []string {
+	if script.HasJapanese(l.English) && !script.Swapped(l.Japanese, l.English) {
+		return []string{fmt.Sprintf("English %q contains Japanese", l.English)}
+	}
+	return nil
+}
+
+func checkEmptyField(f *File, l *Line) []string {
+	var msgs []string
+	for _, field := range fields(l) {
+		if strings.TrimSpace(*field.value) == "" {
+			msgs = append(msgs, fmt.Sprintf("%s is empty", field.name))
+		}
+	}
+	return msgs
+}
+
+// quotedField reports whether a field is correctly quoted: surrounded by
+// quotes because it contains the separator.
+func quotedField(value, sep string) bool {
+	return len(value) > 1 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) &&
+		strings.Contains(value, sep) && !strings.Contains(value[1:len(value)-1], `"`)
+}
+
+func checkStrayQuotes(f *File, l *Line) []string {
+	var msgs []string
+	for _, field := range fields(l) {
+		if strings.Contains(*field.value, `"`) && !quotedField(*field.value, f.Sep) {
+			msgs = append(msgs, fmt.Sprintf("%s %s has stray quotes", field.name, *field.value))
+		}
+	}
+	return msgs
+}
+
+// strayEndQuotes reports whether a field has quotes at its ends it doesn't need.
+func strayEndQuotes(value, sep string) bool {
+	return (strings.HasPrefix(value, `"`) || strings.HasSuffix(value, `"`)) &&
+		!quotedField(value, sep) && !strings.Contains(value, sep)
+}
+
+// canFixStrayQuotes reports whether a field has stray quotes at its ends.
+// Quotes within a field are left alone, since they may be intended.
+func canFixStrayQuotes(f *File, l *Line) bool {
+	for _, field := range fields(l) {
+		if strayEndQuotes(*field.value, f.Sep) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixStrayQuotes removes quotes from the ends of fields that don't need them.
+func fixStrayQuotes(f *File, l *Line) bool {
+	for _, field := range fields(l) {
+		if strayEndQuotes(*field.value, f.Sep) {
+			*field.value = strings.TrimSuffix(strings.TrimPrefix(*field.value, `"`), `"`)
+		}
+	}
+	return true
+}
+
+// glossSeparator matches anything used to separate glosses.
+var glossSeparator = regexp.MustCompile(`\s*[/／;；]\s*`)
+
+// checkGlossSeparator has no fix, since a semicolon or slash doesn't always
+// separate glosses, as in "and/or".
+func checkGlossSeparator(f *File, l *Line) []string {
+	for _, sep := range glossSeparator.FindAllString(l.English, -1) {
+		if sep != " / " {
+			return []string{fmt.Sprintf("English %q separates glosses with %q instead of \" / \"", l.English, sep)}
+		}
+	}
+	return nil
+}
+
+func checkWhitespace(f *File, l *Line) []string {
+	var msgs []string
+	for _, field := range fields(l) {
+		if strings.TrimSpace(*field.value) != *field.value {
+			msgs = append(msgs, fmt.Sprintf("%s %q has leading or trailing whitespace", field.name, *field.value))
+		}
+	}
+	return msgs
+}
+
+func fixWhitespace(f *File, l *Line) bool {
+	for _, field := range fields(l) {
+		*field.value = strings.TrimSpace(*field.value)
+	}
+	return true
+}
+
+var doubledSpaces = regexp.MustCompile(`[ 　]{2,}`)
+
+func checkDoubledSpaces(f *File, l *Line) []string {
+	var msgs []string
+	for _, field := range fields(l) {
+		if doubledSpaces.MatchString(strings.TrimSpace(*field.value)) {
+			msgs = append(msgs, fmt.Sprintf("%s %q has several spaces in a row", field.name, *field.value))
+		}
+	}
+	return msgs
+}
+
+func fixDoubledSpaces(f *File, l *Line) bool {
+	for _, field := range fields(l) {
+		*field.value = doubledSpaces.ReplaceAllString(*field.value, " ")
+	}
+	return true
+}
+
+func checkEmptyTags(f *File, l *Line) []string {
+	if len(l.Tags.Tags) == 0 {
+		return []string{"Entry has no tags"}
+	}
+	return nil
+}
+
+func checkDuplicateLine(f *File, l *Line) []string {
+	if first := f.First(l); first != l {
+		return []string{fmt.Sprintf("Duplicate of line %d", first.Line)}
+	}
+	return nil
+}
+
+func fixDuplicateLine(f *File, l *Line) bool {
+	first := f.First(l)
+	first.MergeMatching(f.matcher, l.Entry)
+	first.fixed = true
+	return false
+}
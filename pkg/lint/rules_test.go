@@ -0,0 +1,68 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func rule(id string) Rule {
+	for _, r := range Rules {
+		if r.ID == id {
+			return r
+		}
+	}
+	panic("no rule " + id)
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		japanese string
+		english  string
+		tags     string
+		problem  bool
+	}{
+		{rule: "swapped-columns", japanese: "to eat", english: "たべる", problem: true},
+		{rule: "swapped-columns", japanese: "たべる", english: "to eat"},
+		{rule: "swapped-columns", japanese: "CD", english: "CD"},
+		{rule: "english-in-japanese", japanese: "to eat", english: "to eat", problem: true},
+		{rule: "english-in-japanese", japanese: "to eat", english: "たべる"},
+		{rule: "english-in-japanese", japanese: "たべる (eat)", english: "to eat", problem: true},
+		{rule: "english-in-japanese", japanese: "Tシャツ", english: "T-shirt"},
+		{rule: "english-in-japanese", japanese: "CDプレーヤー", english: "CD player"},
+		{rule: "japanese-in-english", japanese: "まち", english: "town (町)", problem: true},
+		{rule: "japanese-in-english", japanese: "まち", english: "town"},
+		{rule: "japanese-in-english", japanese: "town", english: "町"},
+		{rule: "no-japanese-script", japanese: "한국어", english: "Korean", problem: true},
+		{rule: "no-japanese-script", japanese: "100", english: "one hundred", problem: true},
+		{rule: "no-japanese-script", japanese: "machi", english: "town"},
+		{rule: "no-japanese-script", japanese: "まち", english: "town"},
+		{rule: "empty-field", japanese: " ", english: "town", problem: true},
+		{rule: "empty-field", japanese: "まち", english: "", problem: true},
+		{rule: "stray-quotes", japanese: "まち", english: `"town"`, problem: true},
+		{rule: "stray-quotes", japanese: "まち", english: `"town`, problem: true},
+		{rule: "stray-quotes", japanese: "はい", english: `"yes, please"`},
+		{rule: "gloss-separator", japanese: "まち", english: "city/town", problem: true},
+		{rule: "gloss-separator", japanese: "まち", english: "city; town", problem: true},
+		{rule: "gloss-separator", japanese: "まち", english: "city / town"},
+		{rule: "whitespace", japanese: "まち　", english: "town", problem: true},
+		{rule: "whitespace", japanese: "まち", english: " town", problem: true},
+		{rule: "whitespace", japanese: "まち", english: "town"},
+		{rule: "doubled-spaces", japanese: "まち", english: "big  city", problem: true},
+		{rule: "doubled-spaces", japanese: "まち", english: "big city "},
+		{rule: "empty-tags", japanese: "まち", english: "town", problem: true},
+		{rule: "empty-tags", japanese: "まち", english: "town", tags: "noun"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule+" "+test.japanese+" "+test.english, func(t *testing.T) {
+			f := &File{Path: "deck.csv", Sep: ","}
+			l := &Line{Entry: types.NewEntry(test.japanese, test.english, test.tags), Line: 1}
+			f.Lines = []*Line{l}
+			f.index(types.ExactMatcher)
+			assert.Equal(t, test.problem, len(rule(test.rule).Check(f, l)) > 0)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+type tokenKind int
+
+const (
+	termToken tokenKind = iota
+	quotedToken
+	andToken
+	orToken
+	notToken
+	openToken
+	closeToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// tokenize splits an expression into tokens. Words and quoted strings are
+// terms, unless they're one of the operator keywords.
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{openToken, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{closeToken, ")"})
+			i++
+		case r == '!':
+			tokens = append(tokens, token{notToken, "!"})
+			i++
+		case r == '&' || r == '|':
+			if i+1 >= len(runes) || runes[i+1] != r {
+				return nil, errors.Errorf("Expected %c%c in %s", r, r, expr)
+			}
+			if r == '&' {
+				tokens = append(tokens, token{andToken, "&&"})
+			} else {
+				tokens = append(tokens, token{orToken, "||"})
+			}
+			i += 2
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errors.Errorf("Unterminated quote in %s", expr)
+			}
+			tokens = append(tokens, token{quotedToken, string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()!&|'\"", runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			switch strings.ToLower(word) {
+			case "and":
+				tokens = append(tokens, token{andToken, word})
+			case "or":
+				tokens = append(tokens, token{orToken, word})
+			case "not":
+				tokens = append(tokens, token{notToken, word})
+			default:
+				tokens = append(tokens, token{termToken, word})
+			}
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// parser is a recursive descent parser over tokens. From loosest to
+// tightest binding, the operators are or, and, then not.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) accept(kind tokenKind) bool {
+	if t, ok := p.peek(); ok && t.kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(orToken) {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(andToken) {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.accept(notToken) {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("Unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case openToken:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(closeToken) {
+			return nil, errors.New("Missing closing parenthesis")
+		}
+		return e, nil
+	case quotedToken:
+		return tagExpr{tag: t.text}, nil
+	case termToken:
+		return newTerm(t.text)
+	}
+	return nil, errors.Errorf("Unexpected %s", t.text)
+}
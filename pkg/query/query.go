@@ -0,0 +1,170 @@
+// Package query parses and evaluates tag expressions, which select entries
+// by their tags.
+//
+// An expression is made of tag terms combined with and, or and not (also
+// written &&, || and !), grouped with parentheses. Terms can be:
+//
+//	verb         the exact tag verb
+//	jlpt:*       any tag matching a wildcard pattern
+//	lesson:3..7  lesson:3 up to lesson:7; either end may be left off
+//	'my tag'     a quoted tag, for tags with special characters
+//
+// For example: lesson:3..7 and not (verb or 'adj')
+//
+// Hierarchical tags imply their parents, so jlpt matches an entry tagged
+// jlpt::n5, and so does jlpt::*.
+package query
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Expr is a parsed tag expression.
+type Expr interface {
+	// Match reports whether a set of tags satisfies the expression.
+	Match(ts *types.TagSet) bool
+	String() string
+}
+
+// Parse parses a tag expression.
+func Parse(expr string) (Expr, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, errors.Errorf("Unexpected %s in %s", t.text, expr)
+	}
+	return e, nil
+}
+
+type andExpr struct{ left, right Expr }
+
+func (e andExpr) Match(ts *types.TagSet) bool { return e.left.Match(ts) && e.right.Match(ts) }
+func (e andExpr) String() string              { return fmt.Sprintf("(%s and %s)", e.left, e.right) }
+
+type orExpr struct{ left, right Expr }
+
+func (e orExpr) Match(ts *types.TagSet) bool { return e.left.Match(ts) || e.right.Match(ts) }
+func (e orExpr) String() string              { return fmt.Sprintf("(%s or %s)", e.left, e.right) }
+
+type notExpr struct{ expr Expr }
+
+func (e notExpr) Match(ts *types.TagSet) bool { return !e.expr.Match(ts) }
+func (e notExpr) String() string              { return fmt.Sprintf("not %s", e.expr) }
+
+// tagExpr matches a single tag exactly.
+type tagExpr struct{ tag string }
+
+func (e tagExpr) Match(ts *types.TagSet) bool { return ts.Has(e.tag) }
+func (e tagExpr) String() string              { return strconv.Quote(e.tag) }
+
+// patternExpr matches tags against a wildcard pattern.
+type patternExpr struct{ pattern string }
+
+func (e patternExpr) Match(ts *types.TagSet) bool {
+	for _, tag := range ts.Expand() {
+		if ok, _ := path.Match(e.pattern, tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (e patternExpr) String() string { return e.pattern }
+
+// rangeExpr matches tags made of a prefix and a number within a range.
+type rangeExpr struct {
+	prefix  string
+	low     int
+	high    int
+	hasLow  bool
+	hasHigh bool
+}
+
+var rangeRegexp = regexp.MustCompile(`^(.*?)(\d*)\.\.(\d*)$`)
+
+func (e rangeExpr) Match(ts *types.TagSet) bool {
+	for _, tag := range ts.Expand() {
+		if !strings.HasPrefix(tag, e.prefix) {
+			continue
+		}
+		number := tag[len(e.prefix):]
+		if number == "" || strings.Trim(number, "0123456789") != "" {
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			continue
+		}
+		if (!e.hasLow || n >= e.low) && (!e.hasHigh || n <= e.high) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e rangeExpr) String() string {
+	var low, high string
+	if e.hasLow {
+		low = strconv.Itoa(e.low)
+	}
+	if e.hasHigh {
+		high = strconv.Itoa(e.high)
+	}
+	return fmt.Sprintf("%s%s..%s", e.prefix, low, high)
+}
+
+// newTerm builds the expression for a single unquoted term.
+func newTerm(term string) (Expr, error) {
+	if m := rangeRegexp.FindStringSubmatch(term); m != nil && (m[2] != "" || m[3] != "") {
+		e := rangeExpr{prefix: m[1]}
+		var err error
+		if m[2] != "" {
+			e.hasLow = true
+			if e.low, err = strconv.Atoi(m[2]); err != nil {
+				return nil, errors.Wrapf(err, "Invalid range %s", term)
+			}
+		}
+		if m[3] != "" {
+			e.hasHigh = true
+			if e.high, err = strconv.Atoi(m[3]); err != nil {
+				return nil, errors.Wrapf(err, "Invalid range %s", term)
+			}
+		}
+		if e.hasLow && e.hasHigh && e.low > e.high {
+			return nil, errors.Errorf("Invalid range %s, %d is greater than %d", term, e.low, e.high)
+		}
+		return e, nil
+	}
+	if strings.ContainsAny(term, `*?[\`) {
+		if _, err := path.Match(term, ""); err != nil {
+			return nil, errors.Wrapf(err, "Invalid pattern %s", term)
+		}
+		return patternExpr{pattern: term}, nil
+	}
+	return tagExpr{tag: term}, nil
+}
+
+// Select returns the entries whose tags match an expression.
+func Select(e Expr, haystack []*types.Entry) []*types.Entry {
+	var selected []*types.Entry
+	for _, entry := range haystack {
+		if e.Match(entry.Tags) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
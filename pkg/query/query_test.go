@@ -0,0 +1,96 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		tags     string
+		expected bool
+	}{
+		{name: "Exact tag", expr: "verb", tags: "3 verb", expected: true},
+		{name: "Missing tag", expr: "verb", tags: "3 noun", expected: false},
+		{name: "Quoted tag", expr: "'verb'", tags: "verb", expected: true},
+		{name: "And", expr: "3 and verb", tags: "3 verb", expected: true},
+		{name: "And with a missing tag", expr: "3 && verb", tags: "3", expected: false},
+		{name: "Or", expr: "noun or verb", tags: "verb", expected: true},
+		{name: "Not", expr: "not verb", tags: "3 verb", expected: false},
+		{name: "Bang not", expr: "!verb", tags: "3", expected: true},
+		{name: "Keywords are case insensitive", expr: "3 AND NOT verb", tags: "3", expected: true},
+		{name: "And binds tighter than or", expr: "noun or verb and 3", tags: "noun", expected: true},
+		{name: "Parentheses group", expr: "(noun or verb) and 3", tags: "noun", expected: false},
+		{name: "Wildcard", expr: "jlpt:*", tags: "jlpt:n5", expected: true},
+		{name: "Wildcard without match", expr: "jlpt:*", tags: "lesson:3", expected: false},
+		{name: "Range with prefix", expr: "lesson:3..7", tags: "lesson:5", expected: true},
+		{name: "Range includes its ends", expr: "lesson:3..7", tags: "lesson:7", expected: true},
+		{name: "Range excludes values outside it", expr: "lesson:3..7", tags: "lesson:10", expected: false},
+		{name: "Range doesn't match other prefixes", expr: "lesson:3..7", tags: "chapter:5", expected: false},
+		{name: "Range ignores leading zeros", expr: "lesson:3..7", tags: "lesson:03", expected: true},
+		{name: "Bare numeric range", expr: "3..7", tags: "1 4", expected: true},
+		{name: "Open ended range", expr: "lesson:5..", tags: "lesson:20", expected: true},
+		{name: "Parent tags are implied", expr: "jlpt", tags: "jlpt::n5", expected: true},
+		{name: "Child tags aren't implied", expr: "jlpt::n5", tags: "jlpt", expected: false},
+		{name: "Partial levels don't match", expr: "pos::verb", tags: "pos::verbal", expected: false},
+		{name: "Wildcard over hierarchy", expr: "pos::*", tags: "pos::verb::godan", expected: true},
+		{name: "Range over hierarchy", expr: "lesson::3..7", tags: "lesson::03::a", expected: true},
+		{
+			name:     "Lessons 3 to 7 but not verbs",
+			expr:     "lesson:3..7 and not 'verb'",
+			tags:     "lesson:4 verb",
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := Parse(test.expr)
+			require.NoError(t, err)
+			ts, err := types.NewTagSet(test.tags)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, e.Match(ts))
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "Empty expression", expr: ""},
+		{name: "Dangling operator", expr: "verb and"},
+		{name: "Missing closing parenthesis", expr: "(verb or noun"},
+		{name: "Extra closing parenthesis", expr: "verb)"},
+		{name: "Unterminated quote", expr: "'verb"},
+		{name: "Single ampersand", expr: "verb & noun"},
+		{name: "Backwards range", expr: "lesson:7..3"},
+		{name: "Bad pattern", expr: "jlpt:[n"},
+		{name: "Two terms without an operator", expr: "verb noun"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	haystack := []*types.Entry{
+		types.NewEntry("まち", "city / town", "lesson:1"),
+		types.NewEntry("うち", "house / home", "lesson:4 noun"),
+		types.NewEntry("たべる", "to eat", "lesson:5 verb"),
+	}
+
+	e, err := Parse("lesson:3..7 and not verb")
+	require.NoError(t, err)
+	assert.Equal(t, []*types.Entry{haystack[1]}, Select(e, haystack))
+}
@@ -0,0 +1,282 @@
+// Package romaji transliterates between kana and romaji, the latin
+// spelling of Japanese, so decks typed in romaji can be read as kana.
+package romaji
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// System is a way of writing Japanese in latin letters.
+type System int
+
+const (
+	// Hepburn spells kana the way English speakers would say them, as in
+	// shi, chi and tsu.
+	Hepburn System = iota + 1
+	// Kunrei spells kana by their row of the kana table, as in si, ti and tu.
+	Kunrei
+)
+
+var systemNames = map[System]string{
+	Hepburn: "hepburn",
+	Kunrei:  "kunrei",
+}
+
+func (s System) String() string {
+	return systemNames[s]
+}
+
+// ParseSystem returns the System with a name, such as hepburn.
+func ParseSystem(name string) (System, error) {
+	for s, n := range systemNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, errors.Errorf("Unknown romaji system %s, expected hepburn or kunrei", name)
+}
+
+// syllable is how a kana, or a kana and a small kana, is spelled in each system.
+type syllable struct {
+	kana    string
+	hepburn string
+	kunrei  string
+}
+
+// syllables are in the order their spellings are preferred when reading
+// romaji, so ji is read as じ rather than ぢ.
+var syllables = []syllable{
+	{"あ", "a", "a"}, {"い", "i", "i"}, {"う", "u", "u"}, {"え", "e", "e"}, {"お", "o", "o"},
+	{"か", "ka", "ka"}, {"き", "ki", "ki"}, {"く", "ku", "ku"}, {"け", "ke", "ke"}, {"こ", "ko", "ko"},
+	{"が", "ga", "ga"}, {"ぎ", "gi", "gi"}, {"ぐ", "gu", "gu"}, {"げ", "ge", "ge"}, {"ご", "go", "go"},
+	{"さ", "sa", "sa"}, {"し", "shi", "si"}, {"す", "su", "su"}, {"せ", "se", "se"}, {"そ", "so", "so"},
+	{"ざ", "za", "za"}, {"じ", "ji", "zi"}, {"ず", "zu", "zu"}, {"ぜ", "ze", "ze"}, {"ぞ", "zo", "zo"},
+	{"た", "ta", "ta"}, {"ち", "chi", "ti"}, {"つ", "tsu", "tu"}, {"て", "te", "te"}, {"と", "to", "to"},
+	{"だ", "da", "da"}, {"ぢ", "ji", "zi"}, {"づ", "zu", "zu"}, {"で", "de", "de"}, {"ど", "do", "do"},
+	{"な", "na", "na"}, {"に", "ni", "ni"}, {"ぬ", "nu", "nu"}, {"ね", "ne", "ne"}, {"の", "no", "no"},
+	{"は", "ha", "ha"}, {"ひ", "hi", "hi"}, {"ふ", "fu", "hu"}, {"へ", "he", "he"}, {"ほ", "ho", "ho"},
+	{"ば", "ba", "ba"}, {"び", "bi", "bi"}, {"ぶ", "bu", "bu"}, {"べ", "be", "be"}, {"ぼ", "bo", "bo"},
+	{"ぱ", "pa", "pa"}, {"ぴ", "pi", "pi"}, {"ぷ", "pu", "pu"}, {"ぺ", "pe", "pe"}, {"ぽ", "po", "po"},
+	{"ま", "ma", "ma"}, {"み", "mi", "mi"}, {"む", "mu", "mu"}, {"め", "me", "me"}, {"も", "mo", "mo"},
+	{"や", "ya", "ya"}, {"ゆ", "yu", "yu"}, {"よ", "yo", "yo"},
+	{"ら", "ra", "ra"}, {"り", "ri", "ri"}, {"る", "ru", "ru"}, {"れ", "re", "re"}, {"ろ", "ro", "ro"},
+	{"わ", "wa", "wa"}, {"を", "o", "o"}, {"ゐ", "i", "i"}, {"ゑ", "e", "e"}, {"ゔ", "vu", "vu"},
+	// Small kana on their own.
+	{"ぁ", "a", "a"}, {"ぃ", "i", "i"}, {"ぅ", "u", "u"}, {"ぇ", "e", "e"}, {"ぉ", "o", "o"},
+	{"ゃ", "ya", "ya"}, {"ゅ", "yu", "yu"}, {"ょ", "yo", "yo"}, {"ゎ", "wa", "wa"},
+}
+
+// yoon are the kana combined with a small ゃ, ゅ or ょ, and how the
+// start of the combination is spelled in each system.
+var yoon = []syllable{
+	{"き", "ky", "ky"}, {"ぎ", "gy", "gy"}, {"し", "sh", "sy"}, {"じ", "j", "zy"},
+	{"ち", "ch", "ty"}, {"ぢ", "j", "zy"}, {"に", "ny", "ny"}, {"ひ", "hy", "hy"},
+	{"び", "by", "by"}, {"ぴ", "py", "py"}, {"み", "my", "my"}, {"り", "ry", "ry"},
+}
+
+// extended are combinations used for loanwords, which both systems spell alike.
+var extended = []syllable{
+	{"しぇ", "she", "sye"}, {"じぇ", "je", "zye"}, {"ちぇ", "che", "tye"},
+	{"ふぁ", "fa", "fa"}, {"ふぃ", "fi", "fi"}, {"ふぇ", "fe", "fe"}, {"ふぉ", "fo", "fo"},
+	{"てぃ", "ti", "ti"}, {"でぃ", "di", "di"}, {"うぃ", "wi", "wi"}, {"うぇ", "we", "we"},
+	{"ゔぁ", "va", "va"}, {"ゔぃ", "vi", "vi"}, {"ゔぇ", "ve", "ve"}, {"ゔぉ", "vo", "vo"},
+}
+
+// variants are spellings read as kana which neither system writes.
+var variants = map[string]string{
+	"wo": "を", "jya": "じゃ", "jyu": "じゅ", "jyo": "じょ", "cya": "ちゃ", "cyu": "ちゅ", "cyo": "ちょ",
+}
+
+var (
+	// toRomaji maps kana to their spelling in each system.
+	toRomaji = make(map[string]map[System]string)
+	// toKana maps spellings in either system to kana.
+	toKana = make(map[string]string)
+)
+
+func init() {
+	add := func(s syllable) {
+		toRomaji[s.kana] = map[System]string{Hepburn: s.hepburn, Kunrei: s.kunrei}
+		for _, spelling := range []string{s.hepburn, s.kunrei} {
+			if _, ok := toKana[spelling]; !ok {
+				toKana[spelling] = s.kana
+			}
+		}
+	}
+	for _, s := range syllables {
+		add(s)
+	}
+	for spelling, kana := range variants {
+		toKana[spelling] = kana
+	}
+	for _, y := range yoon {
+		for _, small := range []struct{ kana, vowel string }{{"ゃ", "a"}, {"ゅ", "u"}, {"ょ", "o"}} {
+			add(syllable{y.kana + small.kana, y.hepburn + small.vowel, y.kunrei + small.vowel})
+		}
+	}
+	for _, s := range extended {
+		add(s)
+	}
+}
+
+// Hiragana returns s with katakana turned into hiragana.
+func Hiragana(s string) string {
+	return strings.Map(func(r rune) rune {
+		// Katakana has the same layout as hiragana, 0x60 code points up.
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - 0x60
+		}
+		return r
+	}, s)
+}
+
+// FromKana spells the kana in s with latin letters. A small っ doubles the
+// consonant after it, ん is written n' before a vowel or y so it isn't read
+// as part of the next syllable, and a long vowel mark ー repeats the vowel
+// before it. Anything other than kana, like kanji, is left as it is.
+func FromKana(s string, system System) string {
+	units := splitKana(Hiragana(s))
+	var b strings.Builder
+	for i, u := range units {
+		next := ""
+		if i+1 < len(units) {
+			if spellings, ok := toRomaji[units[i+1]]; ok {
+				next = spellings[system]
+			}
+		}
+		switch u {
+		case "っ":
+			switch {
+			case strings.HasPrefix(next, "ch"):
+				b.WriteString("t")
+			case next != "" && !isVowel(next[0]):
+				b.WriteByte(next[0])
+			}
+		case "ん":
+			b.WriteString("n")
+			if next != "" && (isVowel(next[0]) || next[0] == 'y') {
+				b.WriteString("'")
+			}
+		case "ー":
+			if written := b.String(); written != "" && isVowel(written[len(written)-1]) {
+				b.WriteByte(written[len(written)-1])
+			} else {
+				b.WriteString(u)
+			}
+		default:
+			if spellings, ok := toRomaji[u]; ok {
+				b.WriteString(spellings[system])
+			} else {
+				b.WriteString(u)
+			}
+		}
+	}
+	return b.String()
+}
+
+// splitKana splits s into syllables, keeping a kana and the small kana
+// after it together when they're spelled as one.
+func splitKana(s string) []string {
+	var units []string
+	for s != "" {
+		_, size := utf8.DecodeRuneInString(s)
+		if _, nextSize := utf8.DecodeRuneInString(s[size:]); nextSize > 0 {
+			if _, ok := toRomaji[s[:size+nextSize]]; ok {
+				size += nextSize
+			}
+		}
+		units = append(units, s[:size])
+		s = s[size:]
+	}
+	return units
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aiueo", c) >= 0
+}
+
+// longVowels spells vowels marked long, as in Tōkyō or Tôkyô, as two vowels.
+var longVowels = strings.NewReplacer(
+	"ā", "aa", "ī", "ii", "ū", "uu", "ē", "ee", "ō", "ou",
+	"â", "aa", "î", "ii", "û", "uu", "ê", "ee", "ô", "ou",
+)
+
+// IsRomaji reports whether s looks like Japanese written in latin letters:
+// letters, with nothing but spaces, apostrophes and hyphens between them.
+func IsRomaji(s string) bool {
+	letters := false
+	for _, r := range longVowels.Replace(strings.ToLower(s)) {
+		switch {
+		case r >= 'a' && r <= 'z':
+			letters = true
+		case r == ' ' || r == '\'' || r == '-':
+		default:
+			return false
+		}
+	}
+	return letters
+}
+
+// ToKana reads romaji in either system, or a mix of both, as hiragana.
+// Long vowels marked with a macron or circumflex are written as two kana,
+// with ō written おう, and a hyphen is a long vowel mark ー. Spaces are
+// dropped, and n' is ん. It returns an error for text that isn't romaji.
+func ToKana(s string) (string, error) {
+	text := longVowels.Replace(strings.ToLower(s))
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		next := byte(0)
+		if i+1 < len(text) {
+			next = text[i+1]
+		}
+		switch {
+		case c == ' ' || c == '\'':
+			i++
+		case c == '-':
+			b.WriteString("ー")
+			i++
+		case c == 'n' && !isVowel(next) && next != 'y':
+			b.WriteString("ん")
+			i++
+		case c == 'm' && (next == 'b' || next == 'p' || next == 'm'):
+			// Traditional Hepburn writes ん as m before these, as in shimbun.
+			b.WriteString("ん")
+			i++
+		case c >= 'a' && c <= 'z' && !isVowel(c) && (next == c || c == 't' && next == 'c'):
+			b.WriteString("っ")
+			i++
+		default:
+			matched := false
+			for size := 3; size > 0 && !matched; size-- {
+				if i+size > len(text) {
+					continue
+				}
+				if kana, ok := toKana[text[i:i+size]]; ok {
+					b.WriteString(kana)
+					i += size
+					matched = true
+				}
+			}
+			if !matched {
+				return "", errors.Errorf("Can't read %q as romaji", s)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// Key returns the form of Japanese text used to match it against other
+// text: hiragana if it's written in kana or romaji, so machi, まち and マチ
+// have the same key. Other text, like kanji, is its own key.
+func Key(s string) string {
+	if IsRomaji(s) {
+		if kana, err := ToKana(s); err == nil {
+			return kana
+		}
+	}
+	return Hiragana(s)
+}
@@ -0,0 +1,97 @@
+package romaji
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromKana(t *testing.T) {
+	tests := []struct {
+		kana    string
+		hepburn string
+		kunrei  string
+	}{
+		{kana: "まち", hepburn: "machi", kunrei: "mati"},
+		{kana: "つくえ", hepburn: "tsukue", kunrei: "tukue"},
+		{kana: "ふじさん", hepburn: "fujisan", kunrei: "huzisan"},
+		{kana: "しゃしん", hepburn: "shashin", kunrei: "syasin"},
+		{kana: "きっぷ", hepburn: "kippu", kunrei: "kippu"},
+		{kana: "まっちゃ", hepburn: "matcha", kunrei: "mattya"},
+		{kana: "ほんや", hepburn: "hon'ya", kunrei: "hon'ya"},
+		{kana: "きんえん", hepburn: "kin'en", kunrei: "kin'en"},
+		{kana: "とうきょう", hepburn: "toukyou", kunrei: "toukyou"},
+		{kana: "コーヒー", hepburn: "koohii", kunrei: "koohii"},
+		{kana: "パーティー", hepburn: "paatii", kunrei: "paatii"},
+		{kana: "日本ご", hepburn: "日本go", kunrei: "日本go"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.kana, func(t *testing.T) {
+			assert.Equal(t, test.hepburn, FromKana(test.kana, Hepburn))
+			assert.Equal(t, test.kunrei, FromKana(test.kana, Kunrei))
+		})
+	}
+}
+
+func TestToKana(t *testing.T) {
+	tests := []struct {
+		romaji      string
+		expected    string
+		expectedErr bool
+	}{
+		{romaji: "machi", expected: "まち"},
+		{romaji: "mati", expected: "まち"},
+		{romaji: "Tsukue", expected: "つくえ"},
+		{romaji: "syasin", expected: "しゃしん"},
+		{romaji: "kippu", expected: "きっぷ"},
+		{romaji: "matcha", expected: "まっちゃ"},
+		{romaji: "hon'ya", expected: "ほんや"},
+		{romaji: "honya", expected: "ほにゃ"},
+		{romaji: "konnichiwa", expected: "こんにちわ"},
+		{romaji: "shimbun", expected: "しんぶん"},
+		{romaji: "Tōkyō", expected: "とうきょう"},
+		{romaji: "Tôkyô", expected: "とうきょう"},
+		{romaji: "ko-hi-", expected: "こーひー"},
+		{romaji: "o genki desu ka", expected: "おげんきですか"},
+		{romaji: "city", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.romaji, func(t *testing.T) {
+			kana, err := ToKana(test.romaji)
+			assert.Equal(t, test.expectedErr, err != nil)
+			assert.Equal(t, test.expected, kana)
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, kana := range []string{"まち", "しゃしん", "きっぷ", "まっちゃ", "ほんや", "きんえん", "ぢ"} {
+		for _, system := range []System{Hepburn, Kunrei} {
+			read, err := ToKana(FromKana(kana, system))
+			assert.NoError(t, err)
+			if kana == "ぢ" {
+				// ぢ is spelled the same as じ.
+				kana = "じ"
+			}
+			assert.Equal(t, kana, read, "%s in %s", kana, system)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "まち", Key("machi"))
+	assert.Equal(t, "まち", Key("まち"))
+	assert.Equal(t, "まち", Key("マチ"))
+	assert.Equal(t, "町", Key("町"))
+	assert.Equal(t, "city", Key("city"))
+}
+
+func TestParseSystem(t *testing.T) {
+	s, err := ParseSystem("kunrei")
+	assert.NoError(t, err)
+	assert.Equal(t, Kunrei, s)
+	_, err = ParseSystem("wapuro")
+	assert.Error(t, err)
+}
@@ -0,0 +1,270 @@
+// Package schema checks entries' tags against a tag schema, to keep typos
+// and inconsistent tagging out of a deck.
+//
+// Schema files have one rule per line. Anything after a # is a comment.
+//
+//	allow TAG...              allow these tags; TAG may be a wildcard like jlpt::*
+//	pattern REGEXP            allow tags matching REGEXP
+//	require NAME TAG...       every entry needs at least one of these tags
+//	exclusive NAME TAG...     no entry may have more than one of these tags
+//
+// If a schema has no allow or pattern rules, any tag name is allowed.
+package schema
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Rule names used in violations.
+const (
+	UnknownTagRule = "unknown-tag"
+	RequiredRule   = "required-tag"
+	ExclusiveRule  = "exclusive-tags"
+)
+
+// RuleDescriptions describe each kind of violation, by rule name.
+var RuleDescriptions = map[string]string{
+	UnknownTagRule: "a tag isn't allowed by the tag schema",
+	RequiredRule:   "an entry is missing a tag the tag schema requires",
+	ExclusiveRule:  "an entry has several tags the tag schema allows only one of",
+}
+
+// Schema describes the tags entries may have.
+type Schema struct {
+	allow     []string
+	patterns  []*regexp.Regexp
+	required  []group
+	exclusive []group
+}
+
+// group is a named set of tag patterns.
+type group struct {
+	name string
+	tags []string
+}
+
+// Violation is a way an entry breaks the schema.
+type Violation struct {
+	Entry *types.Entry
+	// Rule is the kind of violation, such as UnknownTagRule.
+	Rule    string
+	Message string
+	// Sources are the lines responsible for the violation.
+	Sources []types.Source
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s (%s)", types.Locations(v.Sources), v.Message, v.Entry.ToString())
+}
+
+// Load reads a schema from a file.
+func Load(filePath string) (*Schema, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't open schema file")
+	}
+	defer f.Close()
+	s, err := Parse(f)
+	return s, errors.Wrapf(err, "Error in schema file %s", filePath)
+}
+
+// Parse reads a schema from r.
+func Parse(r io.Reader) (*Schema, error) {
+	s := &Schema{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		for i, f := range fields {
+			if strings.HasPrefix(f, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "allow":
+			if len(fields) < 2 {
+				err = errors.New("allow needs at least one tag")
+				break
+			}
+			err = checkPatterns(fields[1:])
+			s.allow = append(s.allow, fields[1:]...)
+		case "pattern":
+			if len(fields) != 2 {
+				err = errors.New("pattern needs a single regular expression")
+				break
+			}
+			var re *regexp.Regexp
+			re, err = regexp.Compile(fields[1])
+			s.patterns = append(s.patterns, re)
+		case "require", "exclusive":
+			if len(fields) < 3 {
+				err = errors.Errorf("%s needs a name and at least one tag", fields[0])
+				break
+			}
+			err = checkPatterns(fields[2:])
+			g := group{name: fields[1], tags: fields[2:]}
+			if fields[0] == "require" {
+				s.required = append(s.required, g)
+			} else {
+				s.exclusive = append(s.exclusive, g)
+			}
+		default:
+			err = errors.Errorf("Unknown rule %s", fields[0])
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Error reading schema")
+	}
+	return s, nil
+}
+
+func checkPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Wrapf(err, "Invalid pattern %s", p)
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether tag matches any of the tag patterns.
+func matchesAny(tag string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether a tag name is allowed by the schema.
+func (s *Schema) Allowed(tag string) bool {
+	if len(s.allow) == 0 && len(s.patterns) == 0 {
+		return true
+	}
+	if matchesAny(tag, s.allow) {
+		return true
+	}
+	for _, re := range s.patterns {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns the ways an entry breaks the schema.
+func (s *Schema) Validate(e *types.Entry) []Violation {
+	var violations []Violation
+	tags := e.Tags.SortNatural()
+	for _, tag := range tags {
+		if !s.Allowed(tag) {
+			violations = append(violations, Violation{
+				Entry:   e,
+				Rule:    UnknownTagRule,
+				Message: fmt.Sprintf("tag %s isn't allowed", tag),
+				Sources: sourcesWithTag(e.Sources, tag),
+			})
+		}
+	}
+
+	for _, g := range s.required {
+		if len(groupTags(tags, g)) == 0 {
+			violations = append(violations, Violation{
+				Entry:   e,
+				Rule:    RequiredRule,
+				Message: fmt.Sprintf("needs a %s tag, one of %s", g.name, strings.Join(g.tags, " ")),
+				Sources: e.Sources,
+			})
+		}
+	}
+
+	for _, g := range s.exclusive {
+		if found := groupTags(tags, g); len(found) > 1 {
+			var sources []types.Source
+			for _, tag := range found {
+				sources = appendMissing(sources, sourcesWithTag(e.Sources, tag))
+			}
+			violations = append(violations, Violation{
+				Entry:   e,
+				Rule:    ExclusiveRule,
+				Message: fmt.Sprintf("has more than one %s tag: %s", g.name, strings.Join(found, " ")),
+				Sources: sources,
+			})
+		}
+	}
+	return violations
+}
+
+// ValidateAll returns the ways a list of entries breaks the schema.
+func (s *Schema) ValidateAll(entries []*types.Entry) []Violation {
+	var violations []Violation
+	for _, e := range entries {
+		violations = append(violations, s.Validate(e)...)
+	}
+	return violations
+}
+
+// groupTags returns the tags belonging to a group.
+func groupTags(tags []string, g group) []string {
+	var found []string
+	for _, tag := range tags {
+		if matchesAny(tag, g.tags) {
+			found = append(found, tag)
+		}
+	}
+	return found
+}
+
+// sourcesWithTag returns the sources that contributed a tag. If none of them
+// did, for example because the tag was added later, all sources are returned.
+func sourcesWithTag(sources []types.Source, tag string) []types.Source {
+	var found []types.Source
+	for _, s := range sources {
+		for _, t := range s.Tags {
+			if t == tag {
+				found = append(found, s)
+				break
+			}
+		}
+	}
+	if found == nil {
+		return sources
+	}
+	return found
+}
+
+func appendMissing(sources, more []types.Source) []types.Source {
+	for _, m := range more {
+		missing := true
+		for _, s := range sources {
+			if s.File == m.File && s.Line == m.Line {
+				missing = false
+				break
+			}
+		}
+		if missing {
+			sources = append(sources, m)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `
+allow verb noun jlpt::*
+pattern ^lesson::\d+$   # lesson numbers
+require lesson lesson::*
+exclusive jlpt jlpt::*
+`
+
+func entryFrom(jp, eng string, sources ...types.Source) *types.Entry {
+	var tags []string
+	for _, s := range sources {
+		tags = append(tags, s.Tags...)
+	}
+	e := types.NewEntry(jp, eng, strings.Join(tags, " "))
+	e.Sources = sources
+	return e
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Parse(strings.NewReader(testSchema))
+	require.NoError(t, err)
+
+	lesson1 := types.Source{File: "lesson1.csv", Line: 2, Tags: []string{"lesson::1", "jlpt::n5"}}
+	typo := types.Source{File: "lesson3.csv", Line: 7, Tags: []string{"lesosn3"}}
+	n4 := types.Source{File: "jlpt.csv", Line: 40, Tags: []string{"lesson::9", "jlpt::n4"}}
+
+	tests := []struct {
+		name          string
+		entry         *types.Entry
+		expectedRules []string
+		expectedLocs  []string
+	}{
+		{
+			name:  "Valid entry",
+			entry: entryFrom("まち", "city / town", lesson1),
+		},
+		{
+			name:          "Unknown tag is blamed on the line that added it",
+			entry:         entryFrom("まち", "city / town", lesson1, typo),
+			expectedRules: []string{UnknownTagRule},
+			expectedLocs:  []string{"lesson3.csv:7"},
+		},
+		{
+			name:          "Missing required tag",
+			entry:         entryFrom("まち", "city / town", typo),
+			expectedRules: []string{UnknownTagRule, RequiredRule},
+			expectedLocs:  []string{"lesson3.csv:7", "lesson3.csv:7"},
+		},
+		{
+			name:          "More than one exclusive tag",
+			entry:         entryFrom("まち", "city / town", lesson1, n4),
+			expectedRules: []string{ExclusiveRule},
+			expectedLocs:  []string{"jlpt.csv:40, lesson1.csv:2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations := s.Validate(test.entry)
+			var rules, locs []string
+			for _, v := range violations {
+				rules = append(rules, v.Rule)
+				locs = append(locs, types.Locations(v.Sources))
+			}
+			assert.Equal(t, test.expectedRules, rules)
+			assert.Equal(t, test.expectedLocs, locs)
+		})
+	}
+}
+
+func TestAllowedWithoutAllowRules(t *testing.T) {
+	s, err := Parse(strings.NewReader("require lesson lesson::*"))
+	require.NoError(t, err)
+	assert.True(t, s.Allowed("anything"))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{name: "Unknown rule", schema: "permit verb"},
+		{name: "Empty allow", schema: "allow"},
+		{name: "Bad pattern", schema: "pattern ("},
+		{name: "Group without tags", schema: "require lesson"},
+		{name: "Bad group pattern", schema: "exclusive jlpt [n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.schema))
+			assert.Error(t, err)
+		})
+	}
+}
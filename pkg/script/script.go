@@ -0,0 +1,185 @@
+// Package script classifies text by the Unicode scripts it's written in, to
+// tell Japanese from English.
+package script
+
+import "unicode"
+
+// Script is the writing system of a single character.
+type Script int
+
+const (
+	// Common characters, like digits, punctuation and spaces, belong to no script.
+	Common Script = iota
+	Kanji
+	Hiragana
+	Katakana
+	Latin
+	// Other is any other script, like Hangul or Cyrillic.
+	Other
+)
+
+var scriptNames = map[Script]string{
+	Common:   "common",
+	Kanji:    "kanji",
+	Hiragana: "hiragana",
+	Katakana: "katakana",
+	Latin:    "latin",
+	Other:    "other",
+}
+
+func (s Script) String() string {
+	return scriptNames[s]
+}
+
+// Of returns the script of a character. The prolonged sound mark ー is
+// counted as katakana and the iteration mark 々 as kanji, although Unicode
+// treats them as common to several scripts.
+func Of(r rune) Script {
+	switch {
+	case r == 'ー' || r == 'ｰ':
+		return Katakana
+	case r == '々' || r == '〆':
+		return Kanji
+	case unicode.Is(unicode.Han, r):
+		return Kanji
+	case unicode.Is(unicode.Hiragana, r):
+		return Hiragana
+	case unicode.Is(unicode.Katakana, r):
+		return Katakana
+	case unicode.Is(unicode.Latin, r):
+		return Latin
+	case unicode.IsLetter(r):
+		return Other
+	}
+	return Common
+}
+
+// IsJapanese reports whether a script is used to write Japanese.
+func (s Script) IsJapanese() bool {
+	return s == Kanji || s == Hiragana || s == Katakana
+}
+
+// Count counts the characters of each script in s.
+func Count(s string) map[Script]int {
+	counts := make(map[Script]int)
+	for _, r := range s {
+		counts[Of(r)]++
+	}
+	return counts
+}
+
+// HasJapanese reports whether s contains any kanji or kana.
+func HasJapanese(s string) bool {
+	for _, r := range s {
+		if Of(r).IsJapanese() {
+			return true
+		}
+	}
+	return false
+}
+
+// Class is the mix of scripts a piece of text is written in.
+type Class int
+
+const (
+	// Empty text has no characters from any script.
+	Empty Class = iota
+	// KanjiOnly text is written only in kanji, like 漢字.
+	KanjiOnly
+	// KanaOnly text is written only in hiragana and katakana, like まち or テレビ.
+	KanaOnly
+	// Mixed text mixes kanji and kana, like 食べる, or Japanese and latin, like Tシャツ.
+	Mixed
+	// LatinOnly text is written only in the latin alphabet, like machi.
+	LatinOnly
+	// OtherOnly text has letters, but no Japanese or latin ones.
+	OtherOnly
+)
+
+var classNames = map[Class]string{
+	Empty:     "empty",
+	KanjiOnly: "kanji",
+	KanaOnly:  "kana",
+	Mixed:     "mixed",
+	LatinOnly: "latin",
+	OtherOnly: "other",
+}
+
+func (c Class) String() string {
+	return classNames[c]
+}
+
+// Classify returns the mix of scripts s is written in. Common characters,
+// like punctuation, are ignored.
+func Classify(s string) Class {
+	counts := Count(s)
+	kanji := counts[Kanji] > 0
+	kana := counts[Hiragana] > 0 || counts[Katakana] > 0
+	latin := counts[Latin] > 0
+	switch {
+	case (kanji || kana) && (latin || kanji && kana):
+		return Mixed
+	case kanji:
+		return KanjiOnly
+	case kana:
+		return KanaOnly
+	case latin:
+		return LatinOnly
+	case counts[Other] > 0:
+		return OtherOnly
+	}
+	return Empty
+}
+
+// Swapped reports whether the Japanese and English text of an entry look
+// swapped: the English has kana or kanji, but the Japanese doesn't.
+func Swapped(japanese, english string) bool {
+	return HasJapanese(english) && !HasJapanese(japanese)
+}
+
+// reversedShare is the share of entries that must look swapped for a whole
+// file to look reversed.
+const reversedShare = 0.8
+
+// MinReversedEntries is the number of entries whose columns can be told
+// apart a file needs before it can look reversed. In smaller files, like a
+// short lesson, a swapped entry is more likely a mistake of its own.
+const MinReversedEntries = 5
+
+// ReversalCounter counts the entries of a file that look swapped, to tell
+// whether the whole file was written with its columns the wrong way round.
+type ReversalCounter struct {
+	swapped int
+	// decided counts the entries with kana or kanji in only one column.
+	// Entries without, like CD,CD, could be either way round.
+	decided int
+}
+
+// Add counts an entry.
+func (c *ReversalCounter) Add(japanese, english string) {
+	if HasJapanese(japanese) == HasJapanese(english) {
+		return
+	}
+	c.decided++
+	if Swapped(japanese, english) {
+		c.swapped++
+	}
+}
+
+// Reversed reports whether the file looks reversed, with most of its
+// entries looking swapped. Files that are TooSmall never look reversed.
+func (c *ReversalCounter) Reversed() bool {
+	return !c.TooSmall() && float64(c.swapped) >= reversedShare*float64(c.decided)
+}
+
+// TooSmall reports whether too few entries have been counted to tell
+// whether the file is reversed.
+func (c *ReversalCounter) TooSmall() bool {
+	return c.decided < MinReversedEntries
+}
+
+// Counts returns the number of entries that look swapped, and the number
+// whose columns could be told apart.
+func (c *ReversalCounter) Counts() (swapped, decided int) {
+	return c.swapped, c.decided
+}
@@ -0,0 +1,126 @@
+package script
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		char     rune
+		expected Script
+	}{
+		{char: '町', expected: Kanji},
+		{char: '々', expected: Kanji},
+		{char: 'ま', expected: Hiragana},
+		{char: 'テ', expected: Katakana},
+		{char: 'ー', expected: Katakana},
+		{char: 'a', expected: Latin},
+		{char: 'Ａ', expected: Latin},
+		{char: '한', expected: Other},
+		{char: '1', expected: Common},
+		{char: '、', expected: Common},
+		{char: ' ', expected: Common},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.char), func(t *testing.T) {
+			assert.Equal(t, test.expected, Of(test.char))
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected Class
+	}{
+		{text: "", expected: Empty},
+		{text: "123!", expected: Empty},
+		{text: "漢字", expected: KanjiOnly},
+		{text: "人々", expected: KanjiOnly},
+		{text: "まち", expected: KanaOnly},
+		{text: "テレビ", expected: KanaOnly},
+		{text: "はい、どうぞ", expected: KanaOnly},
+		{text: "食べる", expected: Mixed},
+		{text: "Tシャツ", expected: Mixed},
+		{text: "city / town", expected: LatinOnly},
+		{text: "город", expected: OtherOnly},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			assert.Equal(t, test.expected, Classify(test.text))
+		})
+	}
+}
+
+func TestHasJapanese(t *testing.T) {
+	assert.True(t, HasJapanese("to eat (食べる)"))
+	assert.True(t, HasJapanese("テレビ"))
+	assert.False(t, HasJapanese("city / town"))
+	assert.False(t, HasJapanese("한국어"))
+}
+
+func TestSwapped(t *testing.T) {
+	assert.True(t, Swapped("city / town", "まち"))
+	assert.False(t, Swapped("まち", "city / town"))
+	assert.False(t, Swapped("まち", "town (町)"))
+	assert.False(t, Swapped("CD", "CD"))
+}
+
+func TestReversalCounter(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  [][2]string
+		reversed bool
+	}{
+		{
+			name:    "Empty files aren't reversed",
+			entries: nil,
+		},
+		{
+			name:    "Files the right way round aren't reversed",
+			entries: [][2]string{{"まち", "city / town"}, {"たべる", "to eat"}},
+		},
+		{
+			name:    "A few swapped entries don't make a file reversed",
+			entries: [][2]string{{"まち", "city / town"}, {"to eat", "たべる"}},
+		},
+		{
+			name: "Files with every entry swapped are reversed",
+			entries: [][2]string{
+				{"city / town", "まち"}, {"to eat", "たべる"}, {"to drink", "のむ"},
+				{"house", "いえ"}, {"dog", "いぬ"}, {"CD", "CD"},
+			},
+			reversed: true,
+		},
+		{
+			name:    "Small files aren't reversed",
+			entries: [][2]string{{"city / town", "まち"}, {"to eat", "たべる"}, {"CD", "CD"}},
+		},
+		{
+			name:    "A single swapped entry doesn't make a file reversed",
+			entries: [][2]string{{"city", "まち"}},
+		},
+		{
+			name: "Files with most entries swapped are reversed",
+			entries: [][2]string{
+				{"city / town", "まち"}, {"to eat", "たべる"}, {"to drink", "のむ"},
+				{"house", "いえ"}, {"テレビ", "television"},
+			},
+			reversed: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c ReversalCounter
+			for _, e := range test.entries {
+				c.Add(e[0], e[1])
+			}
+			assert.Equal(t, test.reversed, c.Reversed())
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package stats summarizes the contents of decks.
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/nrb/csvmerger/pkg/entries"
+	"github.com/nrb/csvmerger/pkg/script"
+	"github.com/nrb/csvmerger/pkg/types"
+)
+
+// Stats summarizes a deck merged from one or more files.
+type Stats struct {
+	// Entries is the number of entries after merging.
+	Entries int `json:"entries"`
+	// Untagged is the number of merged entries without any tags.
+	Untagged int `json:"untagged"`
+	// AverageGlosses is the average number of slash-separated glosses per
+	// merged entry.
+	AverageGlosses float64 `json:"averageGlosses"`
+	// Duplicates is the number of loaded entries equal to an earlier one.
+	Duplicates int `json:"duplicates"`
+	// Redefinitions is the number of loaded entries redefining the
+	// Japanese or English of an earlier one.
+	Redefinitions int          `json:"redefinitions"`
+	Scripts       ScriptCounts `json:"scripts"`
+	// Tags counts the merged entries with each tag, in natural order.
+	// Counts roll up the hierarchy.
+	Tags  []TagCount  `json:"tags"`
+	Files []FileStats `json:"files"`
+}
+
+// ScriptCounts counts merged entries by the scripts of their Japanese text.
+type ScriptCounts struct {
+	Kanji int `json:"kanji"`
+	Kana  int `json:"kana"`
+	Mixed int `json:"mixed"`
+	Latin int `json:"latin"`
+	// Other counts entries with empty Japanese text or text in other scripts.
+	Other int `json:"other"`
+}
+
+// TagCount is the number of entries with a tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// FileStats is what a single file contributed to the deck.
+type FileStats struct {
+	File          string `json:"file"`
+	Entries       int    `json:"entries"`
+	New           int    `json:"new"`
+	Duplicates    int    `json:"duplicates"`
+	Redefinitions int    `json:"redefinitions"`
+}
+
+// Compute merges the entries loaded from each file, in order, and
+// summarizes the result. files names the file each slice of loaded came from.
+// Entries are merged into the first entry matching according to m, so
+// their tags may change.
+func Compute(files []string, loaded [][]*types.Entry, m types.Matcher) *Stats {
+	s := &Stats{Tags: []TagCount{}, Files: []FileStats{}}
+
+	var merged []*types.Entry
+	byKey := make(map[string]*types.Entry)
+	// japanese and english hold the keys of the entries with each term.
+	japanese := make(map[string]map[string]bool)
+	english := make(map[string]map[string]bool)
+	for i, es := range loaded {
+		f := FileStats{File: files[i], Entries: len(es)}
+		for _, e := range es {
+			key := m.Key(e)
+			japaneseTerm, englishTerm := m.Terms(e)
+			// Entries with the same Japanese or English as any earlier
+			// entry that doesn't match them redefine it.
+			if otherKey(japanese[japaneseTerm], key) || otherKey(english[englishTerm], key) {
+				f.Redefinitions++
+			}
+			addKey(japanese, japaneseTerm, key)
+			addKey(english, englishTerm, key)
+			if existing, ok := byKey[key]; ok {
+				existing.MergeMatching(m, e)
+				f.Duplicates++
+				continue
+			}
+			byKey[key] = e
+			merged = append(merged, e)
+			f.New++
+		}
+		s.Duplicates += f.Duplicates
+		s.Redefinitions += f.Redefinitions
+		s.Files = append(s.Files, f)
+	}
+
+	s.Entries = len(merged)
+	glosses := 0
+	for _, e := range merged {
+		if len(e.Tags.Tags) == 0 {
+			s.Untagged++
+		}
+		glosses += len(e.Glosses())
+		switch script.Classify(e.Japanese) {
+		case script.KanjiOnly:
+			s.Scripts.Kanji++
+		case script.KanaOnly:
+			s.Scripts.Kana++
+		case script.Mixed:
+			s.Scripts.Mixed++
+		case script.LatinOnly:
+			s.Scripts.Latin++
+		default:
+			s.Scripts.Other++
+		}
+	}
+	if len(merged) > 0 {
+		s.AverageGlosses = float64(glosses) / float64(len(merged))
+	}
+
+	for tag, count := range entries.CountTags(merged) {
+		s.Tags = append(s.Tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(s.Tags, func(i, j int) bool { return types.NaturalLess(s.Tags[i].Tag, s.Tags[j].Tag) })
+	return s
+}
+
+// otherKey reports whether keys has a key other than key.
+func otherKey(keys map[string]bool, key string) bool {
+	return len(keys) > 1 || (len(keys) == 1 && !keys[key])
+}
+
+// addKey records key as one of the keys of the entries with a term.
+func addKey(terms map[string]map[string]bool, term, key string) {
+	if terms[term] == nil {
+		terms[term] = make(map[string]bool)
+	}
+	terms[term][key] = true
+}
+
+// WriteText writes the statistics in a human readable format.
+func (s *Stats) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Entries:\t%d\n", s.Entries)
+	fmt.Fprintf(tw, "Untagged:\t%d\n", s.Untagged)
+	fmt.Fprintf(tw, "Glosses per entry:\t%.2f\n", s.AverageGlosses)
+	fmt.Fprintf(tw, "Duplicates:\t%d\n", s.Duplicates)
+	fmt.Fprintf(tw, "Redefinitions:\t%d\n", s.Redefinitions)
+
+	fmt.Fprintln(tw, "\nJapanese script:")
+	fmt.Fprintf(tw, "\tkanji\t%d\n", s.Scripts.Kanji)
+	fmt.Fprintf(tw, "\tkana\t%d\n", s.Scripts.Kana)
+	fmt.Fprintf(tw, "\tmixed\t%d\n", s.Scripts.Mixed)
+	fmt.Fprintf(tw, "\tlatin\t%d\n", s.Scripts.Latin)
+	fmt.Fprintf(tw, "\tother\t%d\n", s.Scripts.Other)
+
+	fmt.Fprintln(tw, "\nTags:")
+	for _, t := range s.Tags {
+		fmt.Fprintf(tw, "\t%s\t%d\n", t.Tag, t.Count)
+	}
+
+	fmt.Fprintln(tw, "\nFiles:")
+	fmt.Fprintln(tw, "\tfile\tentries\tnew\tduplicates\tredefinitions")
+	for _, f := range s.Files {
+		fmt.Fprintf(tw, "\t%s\t%d\t%d\t%d\t%d\n", f.File, f.Entries, f.New, f.Duplicates, f.Redefinitions)
+	}
+	return tw.Flush()
+}
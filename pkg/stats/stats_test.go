@@ -0,0 +1,76 @@
+package stats
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompute(t *testing.T) {
+	loaded := [][]*types.Entry{
+		{
+			types.NewEntry("まち", "city / town", "lesson::1"),
+			types.NewEntry("食べる", "to eat", "lesson::2 verb"),
+			types.NewEntry("まち", "city / town", "lesson::10"),
+		},
+		{
+			types.NewEntry("まち", "city / town", "noun"),
+			types.NewEntry("町", "town", ""),
+			types.NewEntry("のむ", "to eat", ""),
+			types.NewEntry("Tシャツ", "T-shirt", "lesson::2"),
+		},
+	}
+	s := Compute([]string{"a.csv", "b.csv"}, loaded, types.ExactMatcher)
+
+	assert.Equal(t, &Stats{
+		Entries:        5,
+		Untagged:       2,
+		AverageGlosses: 6.0 / 5,
+		Duplicates:     2,
+		Redefinitions:  1,
+		Scripts:        ScriptCounts{Kanji: 1, Kana: 2, Mixed: 2},
+		Tags: []TagCount{
+			{Tag: "lesson::1", Count: 1},
+			{Tag: "lesson::2", Count: 2},
+			{Tag: "lesson::10", Count: 1},
+			{Tag: "lesson", Count: 3},
+			{Tag: "noun", Count: 1},
+			{Tag: "verb", Count: 1},
+		},
+		Files: []FileStats{
+			{File: "a.csv", Entries: 3, New: 2, Duplicates: 1},
+			{File: "b.csv", Entries: 4, New: 3, Duplicates: 1, Redefinitions: 1},
+		},
+	}, s)
+}
+
+func TestComputeWithMatcher(t *testing.T) {
+	loaded := [][]*types.Entry{
+		{types.NewEntry("まち", "town", "1")},
+		{types.NewEntry("まち", "city", "2")},
+		{types.NewEntry("むら", "town", "3")},
+	}
+	s := Compute([]string{"a.csv", "b.csv", "c.csv"}, loaded, types.JapaneseMatcher)
+	assert.Equal(t, 2, s.Entries)
+	assert.Equal(t, 1, s.Duplicates)
+	assert.Equal(t, 1, s.Redefinitions)
+	assert.Equal(t, 1.5, s.AverageGlosses)
+	assert.Equal(t, FileStats{File: "c.csv", Entries: 1, New: 1, Redefinitions: 1}, s.Files[2])
+}
+
+func TestComputeEmpty(t *testing.T) {
+	s := Compute(nil, nil, types.ExactMatcher)
+	assert.Equal(t, &Stats{Tags: []TagCount{}, Files: []FileStats{}}, s)
+}
+
+func TestWriteText(t *testing.T) {
+	s := Compute([]string{"a.csv"}, [][]*types.Entry{{types.NewEntry("まち", "city / town", "lesson::1")}}, types.ExactMatcher)
+	var buf bytes.Buffer
+	require.NoError(t, s.WriteText(&buf))
+	assert.Contains(t, buf.String(), "Entries:")
+	assert.Contains(t, buf.String(), "lesson::1")
+	assert.Contains(t, buf.String(), "a.csv")
+}
@@ -0,0 +1,192 @@
+package stream
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Options configure a streaming merge.
+type Options struct {
+	// ChunkSize is the most entries held in memory at once while sorting.
+	ChunkSize int
+	// Dir is where temporary files are created. The default temporary
+	// directory is used if it's empty.
+	Dir string
+	// Inspect, if set, is called with every merged entry before it's
+	// stored, so entries can be checked or amended.
+	Inspect func(*types.Entry)
+	// Duplicate, if set, is called with the entry kept and each entry
+	// equal to it, before their tags are merged.
+	Duplicate func(kept, dup *types.Entry)
+	// Matcher decides which entries are merged. The ExactMatcher is used
+	// if it's nil.
+	Matcher types.Matcher
+}
+
+// Merged holds the result of a streaming merge. Close removes its
+// temporary file and must be called when done.
+type Merged struct {
+	// Redefinitions are groups of entries that define the same Japanese
+	// or English term differently.
+	Redefinitions [][]*types.Entry
+
+	f  *os.File
+	it Iterator
+}
+
+// Merge combines all entries from it with bounded memory. Entries that
+// match according to opts.Matcher are merged into one with the union of
+// their tags, and the result is ordered by Japanese, then English, text.
+//
+// Entries are sorted by English to merge those with the same terms and find
+// English redefinitions, then sorted again by Japanese to do the same for
+// Japanese, and merge entries matching by their Japanese. Entries matching
+// with different Japanese, like those matched by their English alone, are
+// then sorted by their key to merge them, and sorted by Japanese again. The
+// merged entries are kept in a temporary file until they're read.
+func Merge(it Iterator, opts Options) (*Merged, error) {
+	m := opts.Matcher
+	if m == nil {
+		m = types.ExactMatcher
+	}
+	var japanese, english [][]*types.Entry
+	reportJapanese := func(group []*types.Entry) {
+		japanese = append(japanese, group)
+	}
+	reportEnglish := func(group []*types.Entry) {
+		english = append(english, group)
+	}
+	sort := func(it Iterator, key func(*types.Entry) string) (*SortedIterator, error) {
+		return (&Sorter{Key: key, ChunkSize: opts.ChunkSize, Dir: opts.Dir}).Sort(it)
+	}
+
+	byEnglish, err := sort(it, ByEnglish(m))
+	if err != nil {
+		return nil, err
+	}
+	defer byEnglish.Close()
+	apart := &apartIterator{it: Dedupe(byEnglish, m, SameTerms(m), opts.Duplicate), m: m}
+	byJapanese, err := sort(FindRedefinitions(apart, m, EnglishTerm(m), reportEnglish), ByJapanese(m))
+	if err != nil {
+		return nil, err
+	}
+	defer byJapanese.Close()
+	matched := Dedupe(FindRedefinitions(Dedupe(byJapanese, m, SameTerms(m), opts.Duplicate), m, JapaneseTerm(m), reportJapanese), m, m.Key, opts.Duplicate)
+	if apart.found {
+		byKey, err := sort(matched, m.Key)
+		if err != nil {
+			return nil, err
+		}
+		defer byKey.Close()
+		sorted, err := sort(Dedupe(byKey, m, m.Key, opts.Duplicate), ByJapanese(m))
+		if err != nil {
+			return nil, err
+		}
+		defer sorted.Close()
+		matched = sorted
+	}
+
+	merged := &Merged{}
+	merged.f, err = ioutil.TempFile(opts.Dir, "csvmerger-merge")
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't create temporary file")
+	}
+
+	w := spillWriter(merged.f)
+	tee := &teeIterator{
+		it:      matched,
+		w:       w,
+		inspect: opts.Inspect,
+	}
+	for {
+		_, err := tee.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			merged.Close()
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		merged.Close()
+		return nil, err
+	}
+	merged.Redefinitions = append(japanese, english...)
+
+	if _, err := merged.f.Seek(0, io.SeekStart); err != nil {
+		merged.Close()
+		return nil, errors.Wrap(err, "Couldn't read temporary file")
+	}
+	merged.it = spillReader(merged.f)
+	return merged, nil
+}
+
+// Next returns the next merged entry.
+func (m *Merged) Next() (*types.Entry, error) {
+	return m.it.Next()
+}
+
+// Close removes the temporary file holding the merged entries.
+func (m *Merged) Close() error {
+	if m.f == nil {
+		return nil
+	}
+	m.f.Close()
+	err := os.Remove(m.f.Name())
+	m.f = nil
+	return errors.Wrap(err, "Couldn't remove temporary file")
+}
+
+// teeIterator writes, and optionally inspects, every entry it passes through.
+type teeIterator struct {
+	it      Iterator
+	w       *file.Writer
+	inspect func(*types.Entry)
+}
+
+func (t *teeIterator) Next() (*types.Entry, error) {
+	e, err := t.it.Next()
+	if err != nil {
+		return nil, err
+	}
+	if t.inspect != nil {
+		t.inspect(e)
+	}
+	if err := t.w.Write(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// apartIterator passes entries through from an Iterator sorted by English,
+// noting whether any consecutive entries match but have different Japanese,
+// and so won't be next to each other once sorted by Japanese.
+type apartIterator struct {
+	it    Iterator
+	m     types.Matcher
+	found bool
+	// key and japanese are those of the last entry, if seen is set.
+	seen     bool
+	key      string
+	japanese string
+}
+
+func (a *apartIterator) Next() (*types.Entry, error) {
+	e, err := a.it.Next()
+	if err != nil {
+		return nil, err
+	}
+	key := a.m.Key(e)
+	japanese, _ := a.m.Terms(e)
+	if a.seen && key == a.key && japanese != a.japanese {
+		a.found = true
+	}
+	a.seen, a.key, a.japanese = true, key, japanese
+	return e, nil
+}
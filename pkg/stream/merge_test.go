@@ -0,0 +1,220 @@
+package stream
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/entries"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name                  string
+		entries               []*types.Entry
+		expectedEntries       []*types.Entry
+		expectedRedefinitions [][]*types.Entry
+	}{
+		{
+			name: "Equal entries are merged and sorted",
+			entries: []*types.Entry{
+				types.NewEntry("まち", "city / town", "2 3"),
+				types.NewEntry("うち", "house / home", "1"),
+				types.NewEntry("うち", "house / home", "17 2"),
+				types.NewEntry("じんじゃ", "shrine", "4"),
+				types.NewEntry("まち", "city / town", "3"),
+			},
+			expectedEntries: []*types.Entry{
+				types.NewEntry("うち", "house / home", "1 17 2"),
+				types.NewEntry("じんじゃ", "shrine", "4"),
+				types.NewEntry("まち", "city / town", "2 3"),
+			},
+		},
+		{
+			name: "Japanese and English redefinitions are found",
+			entries: []*types.Entry{
+				types.NewEntry("まち", "city", "1"),
+				types.NewEntry("バスてい", "bus stop", "2"),
+				types.NewEntry("まち", "town", "1"),
+				types.NewEntry("バスのりば", "bus stop", "3"),
+				types.NewEntry("まち", "city", "2"),
+			},
+			expectedEntries: []*types.Entry{
+				types.NewEntry("まち", "city", "1 2"),
+				types.NewEntry("まち", "town", "1"),
+				types.NewEntry("バスてい", "bus stop", "2"),
+				types.NewEntry("バスのりば", "bus stop", "3"),
+			},
+			expectedRedefinitions: [][]*types.Entry{
+				{types.NewEntry("まち", "city", "1 2"), types.NewEntry("まち", "town", "1")},
+				{types.NewEntry("バスてい", "bus stop", "2"), types.NewEntry("バスのりば", "bus stop", "3")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "csvmerger")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			merged, err := Merge(Slice(test.entries), Options{ChunkSize: 2, Dir: dir})
+			require.NoError(t, err)
+			actual, err := Collect(merged)
+			require.NoError(t, err)
+			require.NoError(t, merged.Close())
+
+			assert.Equal(t, test.expectedEntries, actual)
+			assert.Equal(t, test.expectedRedefinitions, merged.Redefinitions)
+			leftovers, err := ioutil.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, leftovers)
+		})
+	}
+}
+
+func TestMergeInspectsMergedEntries(t *testing.T) {
+	var inspected []string
+	opts := Options{
+		ChunkSize: 1,
+		Inspect: func(e *types.Entry) {
+			inspected = append(inspected, e.ToString())
+		},
+	}
+
+	merged, err := Merge(Slice([]*types.Entry{
+		types.NewEntry("まち", "city / town", "2"),
+		types.NewEntry("うち", "house / home", "1"),
+		types.NewEntry("まち", "city / town", "1"),
+	}), opts)
+	require.NoError(t, err)
+	defer merged.Close()
+
+	assert.Equal(t, []string{"うち,house / home,1", "まち,city / town,1 2"}, inspected)
+}
+
+func TestMergeWithMatcher(t *testing.T) {
+	input := func() []*types.Entry {
+		return []*types.Entry{
+			types.NewEntry("まち", "city", "1"),
+			types.NewEntry("バスてい", "bus stop", "2"),
+			types.NewEntry("まち", "town", "1"),
+			types.NewEntry("バスのりば", "bus stop", "3"),
+			types.NewEntry("まち", "city", "2"),
+		}
+	}
+	tests := []struct {
+		name                  string
+		matcher               types.Matcher
+		input                 []*types.Entry
+		expectedEntries       []string
+		expectedRedefinitions [][]string
+	}{
+		{
+			name:    "Japanese merges differing English",
+			matcher: types.JapaneseMatcher,
+			input:   input(),
+			expectedEntries: []string{
+				"まち,city / town,1 2",
+				"バスてい,bus stop,2",
+				"バスのりば,bus stop,3",
+			},
+			expectedRedefinitions: [][]string{
+				{"バスてい,bus stop,2", "バスのりば,bus stop,3"},
+			},
+		},
+		{
+			name:    "English merges differing Japanese",
+			matcher: types.EnglishMatcher,
+			input:   input(),
+			expectedEntries: []string{
+				"まち,city,1 2",
+				"まち,town,1",
+				"バスてい / バスのりば,bus stop,2 3",
+			},
+			expectedRedefinitions: [][]string{
+				{"まち,city,1 2", "まち,town,1"},
+			},
+		},
+		{
+			name:    "Terms merged into an entry can still be redefined",
+			matcher: types.JapaneseMatcher,
+			input: []*types.Entry{
+				types.NewEntry("まち", "town", "1"),
+				types.NewEntry("まち", "city", "2"),
+				types.NewEntry("むら", "town", "3"),
+			},
+			expectedEntries: []string{
+				"まち,city / town,1 2",
+				"むら,town,3",
+			},
+			expectedRedefinitions: [][]string{
+				{"まち,town,1", "むら,town,3"},
+			},
+		},
+		{
+			name:    "Japanese merged into an entry can still be redefined",
+			matcher: types.EnglishMatcher,
+			input: []*types.Entry{
+				types.NewEntry("バスてい", "bus stop", "1"),
+				types.NewEntry("バスのりば", "bus stop", "2"),
+				types.NewEntry("バスのりば", "coach stop", "3"),
+			},
+			expectedEntries: []string{
+				"バスてい / バスのりば,bus stop,1 2",
+				"バスのりば,coach stop,3",
+			},
+			expectedRedefinitions: [][]string{
+				{"バスのりば,bus stop,2", "バスのりば,coach stop,3"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, err := Merge(Slice(test.input), Options{ChunkSize: 2, Matcher: test.matcher})
+			require.NoError(t, err)
+			actual, err := Collect(merged)
+			require.NoError(t, err)
+			require.NoError(t, merged.Close())
+
+			assert.Equal(t, test.expectedEntries, toStrings(actual))
+			var redefinitions [][]string
+			for _, group := range merged.Redefinitions {
+				redefinitions = append(redefinitions, toStrings(group))
+			}
+			assert.Equal(t, test.expectedRedefinitions, redefinitions)
+		})
+	}
+}
+
+func TestMergeCombinesGlossesLikeMergeBy(t *testing.T) {
+	input := func() []*types.Entry {
+		return []*types.Entry{
+			types.NewEntry("まち", "town", "1"),
+			types.NewEntry("うち", "house", "1"),
+			types.NewEntry("まち", "city", "2"),
+			types.NewEntry("うち", "home", "2"),
+			types.NewEntry("まち", "street / town", "3"),
+		}
+	}
+	merged, err := Merge(Slice(input()), Options{ChunkSize: 2, Matcher: types.JapaneseMatcher})
+	require.NoError(t, err)
+	defer merged.Close()
+	actual, err := Collect(merged)
+	require.NoError(t, err)
+
+	expected := entries.MergeBy(types.JapaneseMatcher, nil, input())
+	assert.ElementsMatch(t, toStrings(expected), toStrings(actual))
+}
+
+func toStrings(es []*types.Entry) []string {
+	var strs []string
+	for _, e := range es {
+		strs = append(strs, e.ToString())
+	}
+	return strs
+}
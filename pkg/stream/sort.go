@@ -0,0 +1,240 @@
+package stream
+
+import (
+	"container/heap"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// spillSeparator separates fields in temporary files. It's a control
+// character so it won't show up in real entries.
+const spillSeparator = "\x1f"
+
+// spillReader returns a Reader for entries written to a temporary file,
+// which keep the sources and variants they were written with.
+func spillReader(r io.Reader) *file.Reader {
+	reader := file.NewReader(r, spillSeparator, "")
+	reader.Sources = true
+	reader.Variants = true
+	return reader
+}
+
+// spillWriter returns a Writer for entries written to a temporary file by
+// spillReader.
+func spillWriter(w io.Writer) *file.Writer {
+	writer := file.NewWriter(w, spillSeparator)
+	writer.Sources = true
+	writer.Variants = true
+	return writer
+}
+
+// Sorter sorts entries with at most ChunkSize of them in memory at once.
+// Larger inputs are sorted in chunks which are written to temporary
+// files in Dir, then merged back together.
+type Sorter struct {
+	// Key returns the string entries are sorted by. It's called once for
+	// each entry every time it's read.
+	Key       func(*types.Entry) string
+	ChunkSize int
+	// Dir is where temporary files are created. The default temporary
+	// directory is used if it's empty.
+	Dir string
+}
+
+// SortedIterator yields entries in sorted order. Close removes any
+// temporary files and must be called when done.
+type SortedIterator struct {
+	runs  []*run
+	queue *runQueue
+}
+
+// Sort reads all entries from it and returns them in sorted order.
+// Entries that compare equal keep their input order.
+func (s *Sorter) Sort(it Iterator) (*SortedIterator, error) {
+	if s.ChunkSize < 1 {
+		return nil, errors.Errorf("Chunk size must be at least 1, got %d", s.ChunkSize)
+	}
+
+	sorted := &SortedIterator{}
+	chunk := make([]keyedEntry, 0, s.ChunkSize)
+	for {
+		e, err := it.Next()
+		if err != nil && err != io.EOF {
+			sorted.Close()
+			return nil, err
+		}
+		if e != nil {
+			chunk = append(chunk, keyedEntry{key: s.Key(e), entry: e})
+		}
+		if len(chunk) == s.ChunkSize || (err == io.EOF && len(chunk) > 0) {
+			sort.SliceStable(chunk, func(i, j int) bool { return chunk[i].key < chunk[j].key })
+			// Keep the last chunk in memory if it's the only one.
+			if err == io.EOF && len(sorted.runs) == 0 {
+				sorted.runs = append(sorted.runs, &run{chunk: chunk})
+				break
+			}
+			r, spillErr := s.spill(chunk)
+			if spillErr != nil {
+				sorted.Close()
+				return nil, spillErr
+			}
+			sorted.runs = append(sorted.runs, r)
+			chunk = make([]keyedEntry, 0, s.ChunkSize)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	sorted.queue = &runQueue{}
+	for i, r := range sorted.runs {
+		r.index = i
+		if err := r.advance(); err != nil {
+			sorted.Close()
+			return nil, err
+		}
+		if r.head != nil {
+			sorted.queue.runs = append(sorted.queue.runs, r)
+		}
+	}
+	heap.Init(sorted.queue)
+	return sorted, nil
+}
+
+// spill writes a sorted chunk to a temporary file and returns a run reading it back.
+func (s *Sorter) spill(chunk []keyedEntry) (*run, error) {
+	f, err := ioutil.TempFile(s.Dir, "csvmerger-sort")
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't create temporary file")
+	}
+	r := &run{f: f, key: s.Key}
+	w := spillWriter(f)
+	for _, k := range chunk {
+		if err := w.Write(k.entry); err != nil {
+			r.close()
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		r.close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		r.close()
+		return nil, errors.Wrap(err, "Couldn't read temporary file")
+	}
+	r.it = spillReader(f)
+	return r, nil
+}
+
+// Next returns the smallest remaining entry across all sorted runs.
+func (s *SortedIterator) Next() (*types.Entry, error) {
+	if s.queue == nil || s.queue.Len() == 0 {
+		return nil, io.EOF
+	}
+	r := s.queue.runs[0]
+	e := r.head
+	if err := r.advance(); err != nil {
+		return nil, err
+	}
+	if r.head == nil {
+		heap.Pop(s.queue)
+	} else {
+		heap.Fix(s.queue, 0)
+	}
+	return e, nil
+}
+
+// Close removes the temporary files used by the sort.
+func (s *SortedIterator) Close() error {
+	var first error
+	for _, r := range s.runs {
+		if err := r.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	s.runs = nil
+	s.queue = nil
+	return first
+}
+
+// keyedEntry is an entry and the key it's sorted by.
+type keyedEntry struct {
+	key   string
+	entry *types.Entry
+}
+
+// run is a sorted sequence of entries, either in memory or in a temporary
+// file. Entries read from the file have their key computed by key.
+type run struct {
+	chunk   []keyedEntry
+	it      Iterator
+	key     func(*types.Entry) string
+	f       *os.File
+	head    *types.Entry
+	headKey string
+	index   int
+}
+
+func (r *run) advance() error {
+	if r.it == nil {
+		r.head = nil
+		if len(r.chunk) > 0 {
+			r.head, r.headKey = r.chunk[0].entry, r.chunk[0].key
+			r.chunk = r.chunk[1:]
+		}
+		return nil
+	}
+	e, err := r.it.Next()
+	if err == io.EOF {
+		r.head = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.head, r.headKey = e, r.key(e)
+	return nil
+}
+
+func (r *run) close() error {
+	if r.f == nil {
+		return nil
+	}
+	r.f.Close()
+	err := os.Remove(r.f.Name())
+	r.f = nil
+	return errors.Wrap(err, "Couldn't remove temporary file")
+}
+
+// runQueue is a heap of runs, ordered by the key of their first entry.
+// Ties are broken by run order, which keeps the sort stable.
+type runQueue struct {
+	runs []*run
+}
+
+func (q *runQueue) Len() int { return len(q.runs) }
+
+func (q *runQueue) Less(i, j int) bool {
+	a, b := q.runs[i], q.runs[j]
+	if a.headKey != b.headKey {
+		return a.headKey < b.headKey
+	}
+	return a.index < b.index
+}
+
+func (q *runQueue) Swap(i, j int) { q.runs[i], q.runs[j] = q.runs[j], q.runs[i] }
+
+func (q *runQueue) Push(x interface{}) { q.runs = append(q.runs, x.(*run)) }
+
+func (q *runQueue) Pop() interface{} {
+	r := q.runs[len(q.runs)-1]
+	q.runs = q.runs[:len(q.runs)-1]
+	return r
+}
@@ -0,0 +1,62 @@
+package stream
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSorterSort(t *testing.T) {
+	input := []*types.Entry{
+		types.NewEntry("まち", "town", "2"),
+		types.NewEntry("うち", "house / home", "1"),
+		types.NewEntry("じんじゃ", "shrine", ""),
+		types.NewEntry("まち", "city", "1"),
+		types.NewEntry("うち", "house / home", "3"),
+	}
+	expected := []*types.Entry{
+		types.NewEntry("うち", "house / home", "1"),
+		types.NewEntry("うち", "house / home", "3"),
+		types.NewEntry("じんじゃ", "shrine", ""),
+		types.NewEntry("まち", "city", "1"),
+		types.NewEntry("まち", "town", "2"),
+	}
+
+	tests := []struct {
+		name      string
+		chunkSize int
+	}{
+		{name: "Everything fits in memory", chunkSize: 100},
+		{name: "Every entry spills to its own file", chunkSize: 1},
+		{name: "Uneven chunks", chunkSize: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "csvmerger")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			sorter := &Sorter{Key: ByJapanese(types.ExactMatcher), ChunkSize: test.chunkSize, Dir: dir}
+			sorted, err := sorter.Sort(Slice(input))
+			require.NoError(t, err)
+			actual, err := Collect(sorted)
+			require.NoError(t, err)
+			require.NoError(t, sorted.Close())
+
+			assert.Equal(t, expected, actual)
+			leftovers, err := ioutil.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, leftovers)
+		})
+	}
+}
+
+func TestSorterRejectsEmptyChunks(t *testing.T) {
+	_, err := (&Sorter{Key: ByJapanese(types.ExactMatcher)}).Sort(Slice(nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,295 @@
+// Package stream merges decks one entry at a time, so that decks larger
+// than memory can be merged.
+package stream
+
+import (
+	"io"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Iterator yields entries one at a time. Next returns io.EOF once there
+// are no more entries.
+type Iterator interface {
+	Next() (*types.Entry, error)
+}
+
+type sliceIterator struct {
+	entries []*types.Entry
+}
+
+// Slice returns an Iterator over a slice of entries.
+func Slice(entries []*types.Entry) Iterator {
+	return &sliceIterator{entries: entries}
+}
+
+func (s *sliceIterator) Next() (*types.Entry, error) {
+	if len(s.entries) == 0 {
+		return nil, io.EOF
+	}
+	e := s.entries[0]
+	s.entries = s.entries[1:]
+	return e, nil
+}
+
+type concatIterator struct {
+	its []Iterator
+}
+
+// Concat returns an Iterator over the entries of each Iterator in turn.
+func Concat(its ...Iterator) Iterator {
+	return &concatIterator{its: its}
+}
+
+func (c *concatIterator) Next() (*types.Entry, error) {
+	for len(c.its) > 0 {
+		e, err := c.its[0].Next()
+		if err == io.EOF {
+			c.its = c.its[1:]
+			continue
+		}
+		return e, err
+	}
+	return nil, io.EOF
+}
+
+// Collect reads all remaining entries from an Iterator into a slice.
+func Collect(it Iterator) ([]*types.Entry, error) {
+	var entries []*types.Entry
+	for {
+		e, err := it.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// ByJapanese returns the sort key ordering entries by their Japanese, as m
+// compares it, then by their key, so entries that match are next to each
+// other, then by their English as m compares it, then by their Japanese and
+// English text.
+func ByJapanese(m types.Matcher) func(*types.Entry) string {
+	return func(e *types.Entry) string {
+		japanese, english := m.Terms(e)
+		return strings.Join([]string{japanese, m.Key(e), english, e.Japanese, e.English}, "\x00")
+	}
+}
+
+// ByEnglish returns the sort key ordering entries by their English, as m
+// compares it, then by their key, then by their Japanese as m compares it,
+// then by their English and Japanese text.
+func ByEnglish(m types.Matcher) func(*types.Entry) string {
+	return func(e *types.Entry) string {
+		japanese, english := m.Terms(e)
+		return strings.Join([]string{english, m.Key(e), japanese, e.English, e.Japanese}, "\x00")
+	}
+}
+
+// JapaneseTerm returns the Japanese of entries as m compares it.
+func JapaneseTerm(m types.Matcher) func(*types.Entry) string {
+	return func(e *types.Entry) string {
+		japanese, _ := m.Terms(e)
+		return japanese
+	}
+}
+
+// EnglishTerm returns the English of entries as m compares it.
+func EnglishTerm(m types.Matcher) func(*types.Entry) string {
+	return func(e *types.Entry) string {
+		_, english := m.Terms(e)
+		return english
+	}
+}
+
+// SameTerms returns what identifies entries that match according to m and
+// have the same Japanese and English as m compares them, so merging them
+// adds no variants.
+func SameTerms(m types.Matcher) func(*types.Entry) string {
+	return func(e *types.Entry) string {
+		japanese, english := m.Terms(e)
+		return strings.Join([]string{m.Key(e), japanese, english}, "\x00")
+	}
+}
+
+type dedupeIterator struct {
+	it      Iterator
+	m       types.Matcher
+	key     func(*types.Entry) string
+	report  func(kept, dup *types.Entry)
+	next    *types.Entry
+	nextKey string
+	err     error
+}
+
+// Dedupe merges consecutive entries with the same key, as given by key,
+// so a sorted Iterator yields each entry once. Entries with the same key
+// must match according to m, which merges them. If report isn't nil, it's
+// called with the entry kept and each duplicate, before they're merged.
+func Dedupe(it Iterator, m types.Matcher, key func(*types.Entry) string, report func(kept, dup *types.Entry)) Iterator {
+	return &dedupeIterator{it: it, m: m, key: key, report: report}
+}
+
+func (d *dedupeIterator) Next() (*types.Entry, error) {
+	current, currentKey := d.next, d.nextKey
+	d.next = nil
+	if current == nil {
+		if d.err != nil {
+			return nil, d.err
+		}
+		var err error
+		current, err = d.it.Next()
+		if err != nil {
+			return nil, err
+		}
+		currentKey = d.key(current)
+	}
+
+	for {
+		e, err := d.it.Next()
+		if err != nil {
+			// Hand back what we have, and the error on the following call.
+			d.err = err
+			return current, nil
+		}
+		if key := d.key(e); key != currentKey {
+			d.next, d.nextKey = e, key
+			return current, nil
+		}
+		if d.report != nil {
+			d.report(current, e)
+		}
+		if err := current.MergeMatching(d.m, e); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type redefinitionIterator struct {
+	it        Iterator
+	m         types.Matcher
+	term      func(*types.Entry) string
+	report    func([]*types.Entry)
+	group     []*types.Entry
+	groupTerm string
+	groupKey  string
+	redefined bool
+}
+
+// FindRedefinitions passes entries through from a sorted, deduplicated
+// Iterator. Runs of consecutive entries with the same term, as given by
+// term, are redefinitions if they don't all match according to m, and are
+// passed to report.
+func FindRedefinitions(it Iterator, m types.Matcher, term func(*types.Entry) string, report func([]*types.Entry)) Iterator {
+	return &redefinitionIterator{it: it, m: m, term: term, report: report}
+}
+
+func (r *redefinitionIterator) Next() (*types.Entry, error) {
+	e, err := r.it.Next()
+	if err != nil {
+		r.flush()
+		return nil, err
+	}
+	term, key := r.term(e), r.m.Key(e)
+	if len(r.group) > 0 && term != r.groupTerm {
+		r.flush()
+	}
+	if len(r.group) == 0 {
+		r.groupTerm, r.groupKey = term, key
+	} else if key != r.groupKey {
+		r.redefined = true
+	}
+	r.group = append(r.group, e)
+	return e, nil
+}
+
+func (r *redefinitionIterator) flush() {
+	if r.redefined {
+		r.report(r.group)
+	}
+	r.group = nil
+	r.redefined = false
+}
+
+type filesIterator struct {
+	paths   []string
+	opts    file.Options
+	current io.ReadCloser
+	reader  *file.Reader
+}
+
+// Files returns an Iterator over the entries of each file in turn. Files
+// are opened one at a time, as they're reached, and their entries read as
+// opts say.
+func Files(paths []string, opts file.Options) Iterator {
+	return &filesIterator{paths: paths, opts: opts}
+}
+
+func (f *filesIterator) Next() (*types.Entry, error) {
+	for {
+		if f.reader == nil {
+			if len(f.paths) == 0 {
+				return nil, io.EOF
+			}
+			path := f.paths[0]
+			f.paths = f.paths[1:]
+			rc, err := file.Open(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error with file %s", path)
+			}
+			f.current = rc
+			f.reader = f.opts.NewReader(rc, path)
+		}
+
+		e, err := f.reader.Next()
+		if err == io.EOF {
+			f.current.Close()
+			f.current, f.reader = nil, nil
+			continue
+		}
+		return e, err
+	}
+}
+
+type filterIterator struct {
+	it   Iterator
+	keep func(*types.Entry) bool
+}
+
+// Filter returns an Iterator over the entries of it for which keep returns true.
+func Filter(it Iterator, keep func(*types.Entry) bool) Iterator {
+	return &filterIterator{it: it, keep: keep}
+}
+
+func (f *filterIterator) Next() (*types.Entry, error) {
+	for {
+		e, err := f.it.Next()
+		if err != nil || f.keep(e) {
+			return e, err
+		}
+	}
+}
+
+type mapIterator struct {
+	it Iterator
+	f  func(*types.Entry)
+}
+
+// Map returns an Iterator over the entries of it, each changed by f.
+func Map(it Iterator, f func(*types.Entry)) Iterator {
+	return &mapIterator{it: it, f: f}
+}
+
+func (m *mapIterator) Next() (*types.Entry, error) {
+	e, err := m.it.Next()
+	if err == nil {
+		m.f(e)
+	}
+	return e, err
+}
@@ -0,0 +1,137 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcat(t *testing.T) {
+	it := Concat(
+		Slice([]*types.Entry{types.NewEntry("まち", "city / town", "1")}),
+		Slice(nil),
+		Slice([]*types.Entry{types.NewEntry("うち", "house / home", "2")}),
+	)
+
+	actual, err := Collect(it)
+	require.NoError(t, err)
+	assert.Equal(t, []*types.Entry{
+		types.NewEntry("まち", "city / town", "1"),
+		types.NewEntry("うち", "house / home", "2"),
+	}, actual)
+}
+
+func TestFilter(t *testing.T) {
+	it := Filter(Slice([]*types.Entry{
+		types.NewEntry("まち", "city / town", "1"),
+		types.NewEntry("うち", "house / home", "2"),
+	}), func(e *types.Entry) bool {
+		return e.Tags.Tags["2"]
+	})
+
+	actual, err := Collect(it)
+	require.NoError(t, err)
+	assert.Equal(t, []*types.Entry{types.NewEntry("うち", "house / home", "2")}, actual)
+}
+
+func TestMap(t *testing.T) {
+	it := Map(Slice([]*types.Entry{
+		types.NewEntry("city / town", "まち", "1"),
+	}), (*types.Entry).SwapFields)
+
+	actual, err := Collect(it)
+	require.NoError(t, err)
+	assert.Equal(t, []*types.Entry{types.NewEntry("まち", "city / town", "1")}, actual)
+}
+
+func TestDedupe(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []*types.Entry
+		expected []*types.Entry
+	}{
+		{
+			name:     "Empty input",
+			entries:  nil,
+			expected: nil,
+		},
+		{
+			name: "Consecutive equal entries have their tags merged",
+			entries: []*types.Entry{
+				types.NewEntry("うち", "house / home", "1"),
+				types.NewEntry("うち", "house / home", "2"),
+				types.NewEntry("まち", "city / town", "3"),
+				types.NewEntry("まち", "city / town", "3 4"),
+			},
+			expected: []*types.Entry{
+				types.NewEntry("うち", "house / home", "1 2"),
+				types.NewEntry("まち", "city / town", "3 4"),
+			},
+		},
+		{
+			name: "Different entries are untouched",
+			entries: []*types.Entry{
+				types.NewEntry("うち", "house / home", "1"),
+				types.NewEntry("まち", "city / town", "3"),
+			},
+			expected: []*types.Entry{
+				types.NewEntry("うち", "house / home", "1"),
+				types.NewEntry("まち", "city / town", "3"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := Collect(Dedupe(Slice(test.entries), types.ExactMatcher, types.ExactMatcher.Key, nil))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestDedupeReportsDuplicates(t *testing.T) {
+	var reported [][2]string
+	report := func(kept, dup *types.Entry) {
+		reported = append(reported, [2]string{kept.ToString(), dup.ToString()})
+	}
+	input := []*types.Entry{
+		types.NewEntry("うち", "house / home", "1"),
+		types.NewEntry("うち", "house / home", "2"),
+		types.NewEntry("うち", "house / home", "3"),
+		types.NewEntry("まち", "city / town", "3"),
+	}
+	_, err := Collect(Dedupe(Slice(input), types.ExactMatcher, types.ExactMatcher.Key, report))
+	require.NoError(t, err)
+	assert.Equal(t, [][2]string{
+		{"うち,house / home,1", "うち,house / home,2"},
+		{"うち,house / home,1 2", "うち,house / home,3"},
+	}, reported)
+}
+
+func TestFindRedefinitions(t *testing.T) {
+	var groups [][]*types.Entry
+	report := func(group []*types.Entry) {
+		groups = append(groups, group)
+	}
+	input := []*types.Entry{
+		types.NewEntry("うち", "house / home", "1"),
+		types.NewEntry("まち", "city", "1"),
+		types.NewEntry("まち", "town", "2"),
+	}
+
+	actual, err := Collect(FindRedefinitions(Slice(input), types.ExactMatcher, JapaneseTerm(types.ExactMatcher), report))
+	require.NoError(t, err)
+	assert.Equal(t, input, actual)
+	assert.Equal(t, [][]*types.Entry{
+		{types.NewEntry("まち", "city", "1"), types.NewEntry("まち", "town", "2")},
+	}, groups)
+
+	// Entries sharing a term aren't redefinitions if they match.
+	groups = nil
+	_, err = Collect(FindRedefinitions(Slice(input), types.JapaneseMatcher, JapaneseTerm(types.JapaneseMatcher), report))
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+}
@@ -0,0 +1,164 @@
+// Package tagrules rewrites tags according to a rules file, so that tags
+// written differently by different contributors end up the same.
+//
+// Rules files have one rule per line. Anything after a # is a comment.
+//
+//	rename OLD NEW             rename OLD, and every tag below it, to NEW
+//	alias CANONICAL ALIAS...   replace each ALIAS with CANONICAL
+//	deny TAG...                remove TAG and every tag below it; TAG may be a wildcard
+//	rewrite REGEXP REPLACEMENT rewrite tags matching REGEXP, with $1 for submatches
+//
+// Rewrites are applied first, in file order, then renames, aliases and
+// finally the deny list, which applies to the rewritten tags.
+package tagrules
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Rules rewrite tags. They implement types.TagRewriter.
+type Rules struct {
+	rewrites []rewrite
+	renames  map[string]string
+	aliases  map[string]string
+	deny     []string
+	// renameOrder lists the renamed tags longest first, so pos::verb
+	// wins over pos for pos::verb::godan.
+	renameOrder []string
+}
+
+type rewrite struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// Load reads rules from a file.
+func Load(filePath string) (*Rules, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't open rules file")
+	}
+	defer f.Close()
+	rules, err := Parse(f)
+	return rules, errors.Wrapf(err, "Error in rules file %s", filePath)
+}
+
+// Parse reads rules from r.
+func Parse(r io.Reader) (*Rules, error) {
+	rules := &Rules{
+		renames: make(map[string]string),
+		aliases: make(map[string]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		for i, f := range fields {
+			if strings.HasPrefix(f, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "rename":
+			if len(fields) != 3 {
+				err = errors.New("rename needs an old and a new tag")
+				break
+			}
+			rules.renames[fields[1]] = fields[2]
+		case "alias":
+			if len(fields) < 3 {
+				err = errors.New("alias needs a canonical tag and at least one alias")
+				break
+			}
+			for _, alias := range fields[2:] {
+				rules.aliases[alias] = fields[1]
+			}
+		case "deny":
+			if len(fields) < 2 {
+				err = errors.New("deny needs at least one tag")
+				break
+			}
+			for _, tag := range fields[1:] {
+				if _, matchErr := path.Match(tag, ""); matchErr != nil {
+					err = errors.Wrapf(matchErr, "Invalid pattern %s", tag)
+					break
+				}
+				rules.deny = append(rules.deny, tag)
+			}
+		case "rewrite":
+			if len(fields) != 3 {
+				err = errors.New("rewrite needs a regular expression and a replacement")
+				break
+			}
+			var re *regexp.Regexp
+			re, err = regexp.Compile(fields[1])
+			if err == nil {
+				rules.rewrites = append(rules.rewrites, rewrite{re: re, replacement: fields[2]})
+			}
+		default:
+			err = errors.Errorf("Unknown rule %s", fields[0])
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Error reading rules")
+	}
+
+	for old := range rules.renames {
+		rules.renameOrder = append(rules.renameOrder, old)
+	}
+	sort.Slice(rules.renameOrder, func(i, j int) bool {
+		return len(rules.renameOrder[i]) > len(rules.renameOrder[j])
+	})
+	return rules, nil
+}
+
+// Rewrite returns the tag that should be used in place of tag, or false
+// if the tag should be removed.
+func (r *Rules) Rewrite(tag string) (string, bool) {
+	for _, rw := range r.rewrites {
+		tag = rw.re.ReplaceAllString(tag, rw.replacement)
+	}
+	tag = r.rename(tag)
+	if canonical, ok := r.aliases[tag]; ok {
+		tag = canonical
+	}
+	for _, d := range r.deny {
+		if tag == d || types.IsTagDescendant(tag, d) {
+			return "", false
+		}
+		if ok, _ := path.Match(d, tag); ok {
+			return "", false
+		}
+	}
+	return tag, tag != ""
+}
+
+// rename applies the most specific rename matching tag or one of its parents.
+func (r *Rules) rename(tag string) string {
+	for _, old := range r.renameOrder {
+		if tag == old || types.IsTagDescendant(tag, old) {
+			return r.renames[old] + strings.TrimPrefix(tag, old)
+		}
+	}
+	return tag
+}
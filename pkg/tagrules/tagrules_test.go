@@ -0,0 +1,82 @@
+package tagrules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+# Contributors disagree on what to call verbs
+alias verb v Verb 動詞 # trailing comments are ignored
+rename pos::verb verb
+rename pos pos2
+deny draft todo::*
+rewrite ^lesson(\d+)$ lesson::$1
+`
+
+func TestRewrite(t *testing.T) {
+	rules, err := Parse(strings.NewReader(testRules))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		tag          string
+		expectedTag  string
+		expectedKeep bool
+	}{
+		{name: "Untouched tag", tag: "noun", expectedTag: "noun", expectedKeep: true},
+		{name: "Alias", tag: "v", expectedTag: "verb", expectedKeep: true},
+		{name: "Japanese alias", tag: "動詞", expectedTag: "verb", expectedKeep: true},
+		{name: "Rename", tag: "pos::verb", expectedTag: "verb", expectedKeep: true},
+		{name: "Rename applies to subtree", tag: "pos::verb::godan", expectedTag: "verb::godan", expectedKeep: true},
+		{name: "Most specific rename wins", tag: "pos::noun", expectedTag: "pos2::noun", expectedKeep: true},
+		{name: "Denied tag", tag: "draft", expectedKeep: false},
+		{name: "Denied tag's children", tag: "draft::old", expectedKeep: false},
+		{name: "Denied pattern", tag: "todo::check", expectedKeep: false},
+		{name: "Regexp rewrite", tag: "lesson3", expectedTag: "lesson::3", expectedKeep: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tag, keep := rules.Rewrite(test.tag)
+			assert.Equal(t, test.expectedKeep, keep)
+			if test.expectedKeep {
+				assert.Equal(t, test.expectedTag, tag)
+			}
+		})
+	}
+}
+
+func TestRewriteTagSet(t *testing.T) {
+	rules, err := Parse(strings.NewReader(testRules))
+	require.NoError(t, err)
+
+	ts := &types.TagSet{Tags: map[string]bool{"v": true, "Verb": true, "draft": true, "3": true}}
+	ts.Rewrite(rules)
+	assert.Equal(t, &types.TagSet{Tags: map[string]bool{"verb": true, "3": true}}, ts)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{name: "Unknown rule", rules: "replace a b"},
+		{name: "Rename without new tag", rules: "rename a"},
+		{name: "Alias without aliases", rules: "alias verb"},
+		{name: "Empty deny", rules: "deny"},
+		{name: "Bad deny pattern", rules: "deny [a"},
+		{name: "Bad regexp", rules: "rewrite ( a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.rules))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -2,14 +2,20 @@ package types
 
 import (
 	"fmt"
-
-	"github.com/pkg/errors"
+	"sort"
 )
 
 type Entry struct {
 	Japanese string
 	English  string
 	Tags     *TagSet
+	// Sources are the lines this entry was loaded from. Entries merged
+	// into this one add their sources.
+	Sources []Source
+	// Variants are the Japanese and English of entries merged into this
+	// one that differ from its own, as the matcher merging them compares
+	// them. They're combined with the entry's own text when it's written.
+	Variants []Variant
 }
 
 func NewEntry(jpText, engText, tags string) *Entry {
@@ -22,26 +28,57 @@ func NewEntry(jpText, engText, tags string) *Entry {
 }
 
 func (e *Entry) ToString() string {
-	return fmt.Sprintf("%s,%s,%s", e.Japanese, e.English, e.Tags.ToString())
+	japanese, english := e.Text()
+	return fmt.Sprintf("%s,%s,%s", japanese, english, e.Tags.ToString())
+}
+
+// Text returns the Japanese and English of the entry, combined with those
+// of its variants as slash-separated glosses. They're combined in sorted
+// order, so the text doesn't depend on which entry was merged into which.
+func (e *Entry) Text() (japanese, english string) {
+	if len(e.Variants) == 0 {
+		return e.Japanese, e.English
+	}
+	all := append([]Variant{{Japanese: e.Japanese, English: e.English}}, e.Variants...)
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Japanese != all[j].Japanese {
+			return all[i].Japanese < all[j].Japanese
+		}
+		return all[i].English < all[j].English
+	})
+	for _, v := range all {
+		japanese = mergeGlosses(japanese, v.Japanese)
+		english = mergeGlosses(english, v.English)
+	}
+	return japanese, english
+}
+
+// Glosses returns the slash-separated glosses in the English text, like
+// city and town for "city / town", including those of its variants.
+func (e *Entry) Glosses() []string {
+	_, english := e.Text()
+	return splitGlosses(english)
+}
+
+// SwapFields swaps the Japanese and English text, for entries written the
+// wrong way round.
+func (e *Entry) SwapFields() {
+	e.Japanese, e.English = e.English, e.Japanese
 }
 
 // EntriesAreEqual compares the Japanese and English fields of an Entry for equality.
 func EntriesAreEqual(e1, e2 *Entry) bool {
 	return e1.Japanese == e2.Japanese && e1.English == e2.English
-
 }
 
 // EntriesRedefined looks for redfined terms in either Japanese or English.
 // Entries are only redfined if one field is the same; if both are the same,
 // the entry is considered equal, not a redefinition.
 func EntriesRedefined(e1, e2 *Entry) bool {
-	return (e1.Japanese == e2.Japanese || e1.English == e2.English) && !EntriesAreEqual(e1, e2)
+	return EntriesRedefinedBy(ExactMatcher, e1, e2)
 }
 
+// MergeTags adds the tags and sources of an equal entry to this one.
 func (e *Entry) MergeTags(source *Entry) error {
-	if !EntriesAreEqual(e, source) {
-		return errors.New("Cannot merge unequal entries")
-	}
-	e.Tags.Insert(source.Tags.ToString())
-	return nil
+	return e.MergeMatching(ExactMatcher, source)
 }
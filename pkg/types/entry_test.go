@@ -160,6 +160,20 @@ func TestEntryMergeTags(t *testing.T) {
 	}
 }
 
+func TestEntryMergeTagsKeepsSources(t *testing.T) {
+	base := NewEntry(machi, "city / town", "1")
+	base.Sources = []Source{{File: "lesson1.csv", Line: 3, Tags: []string{"1"}}}
+	layered := NewEntry(machi, "city / town", "2")
+	layered.Sources = []Source{{File: "lesson2.csv", Line: 8, Tags: []string{"2"}}}
+
+	err := base.MergeTags(layered)
+	assert.NoError(t, err)
+	assert.Equal(t, []Source{
+		{File: "lesson1.csv", Line: 3, Tags: []string{"1"}},
+		{File: "lesson2.csv", Line: 8, Tags: []string{"2"}},
+	}, base.Sources)
+}
+
 func TestEntriesRedefined(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -194,3 +208,21 @@ func TestEntriesRedefined(t *testing.T) {
 		})
 	}
 }
+
+func TestEntryGlosses(t *testing.T) {
+	tests := []struct {
+		english  string
+		expected []string
+	}{
+		{english: "city / town", expected: []string{"city", "town"}},
+		{english: "to eat", expected: []string{"to eat"}},
+		{english: "a/b//", expected: []string{"a", "b"}},
+		{english: "", expected: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.english, func(t *testing.T) {
+			assert.Equal(t, test.expected, NewEntry(machi, test.english, "").Glosses())
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"strings"
+)
+
+// TagSeparator separates the levels of a hierarchical tag, as in Anki's
+// jlpt::n5 or pos::verb::godan.
+const TagSeparator = "::"
+
+// TagParents returns the ancestors of a hierarchical tag, from the top
+// level down. The parents of pos::verb::godan are pos and pos::verb.
+func TagParents(tag string) []string {
+	var parents []string
+	for i := strings.Index(tag, TagSeparator); i > 0; {
+		parents = append(parents, tag[:i])
+		next := strings.Index(tag[i+len(TagSeparator):], TagSeparator)
+		if next < 0 {
+			break
+		}
+		i += len(TagSeparator) + next
+	}
+	return parents
+}
+
+// TagLevel returns how deep a tag is in the hierarchy, starting from 1 for
+// top level tags.
+func TagLevel(tag string) int {
+	return strings.Count(tag, TagSeparator) + 1
+}
+
+// IsTagDescendant reports whether tag is below parent in the hierarchy.
+func IsTagDescendant(tag, parent string) bool {
+	return strings.HasPrefix(tag, parent+TagSeparator)
+}
+
+// Has reports whether the TagSet has a tag, either directly or implied by
+// one of the tags below it. A TagSet with jlpt::n5 has jlpt.
+func (ts *TagSet) Has(tag string) bool {
+	if ts.Tags[tag] {
+		return true
+	}
+	for t := range ts.Tags {
+		if IsTagDescendant(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand returns the tags in a TagSet along with all of their parents,
+// sorted in NaturalOrder.
+func (ts *TagSet) Expand() []string {
+	expanded := make(map[string]bool)
+	for t := range ts.Tags {
+		expanded[t] = true
+		for _, p := range TagParents(t) {
+			expanded[p] = true
+		}
+	}
+	return (&TagSet{Tags: expanded}).SortNatural()
+}
+
+// Rename renames a tag, along with every tag below it. Renaming pos::verb
+// to verb turns pos::verb::godan into verb::godan.
+func (ts *TagSet) Rename(old, new string) {
+	renamed := make(map[string]string)
+	for t := range ts.Tags {
+		if t == old || IsTagDescendant(t, old) {
+			renamed[t] = new + strings.TrimPrefix(t, old)
+		}
+	}
+	for from := range renamed {
+		delete(ts.Tags, from)
+	}
+	for _, to := range renamed {
+		ts.Tags[to] = true
+	}
+}
+
+// Flatten returns a new TagSet with the levels of hierarchical tags joined by sep.
+func (ts *TagSet) Flatten(sep string) *TagSet {
+	flat := make(map[string]bool)
+	for t := range ts.Tags {
+		flat[strings.Replace(t, TagSeparator, sep, -1)] = true
+	}
+	return &TagSet{Tags: flat}
+}
@@ -0,0 +1,120 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagParents(t *testing.T) {
+	tests := []struct {
+		name            string
+		tag             string
+		expectedParents []string
+		expectedLevel   int
+	}{
+		{
+			name:            "Flat tag has no parents",
+			tag:             "verb",
+			expectedParents: nil,
+			expectedLevel:   1,
+		},
+		{
+			name:            "Two levels",
+			tag:             "jlpt::n5",
+			expectedParents: []string{"jlpt"},
+			expectedLevel:   2,
+		},
+		{
+			name:            "Three levels",
+			tag:             "pos::verb::godan",
+			expectedParents: []string{"pos", "pos::verb"},
+			expectedLevel:   3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectedParents, TagParents(test.tag))
+			assert.Equal(t, test.expectedLevel, TagLevel(test.tag))
+		})
+	}
+}
+
+func TestTagSetHas(t *testing.T) {
+	ts, err := NewTagSet("jlpt::n5 pos::verb::godan 3")
+	require.NoError(t, err)
+
+	assert.True(t, ts.Has("3"))
+	assert.True(t, ts.Has("jlpt"))
+	assert.True(t, ts.Has("jlpt::n5"))
+	assert.True(t, ts.Has("pos::verb"))
+	assert.False(t, ts.Has("jlpt::n4"))
+	assert.False(t, ts.Has("pos::verb::godan::extra"))
+	assert.False(t, ts.Has("po"))
+}
+
+func TestTagSetExpand(t *testing.T) {
+	ts, err := NewTagSet("pos::verb::godan jlpt::n5 lesson::10 lesson::2")
+	require.NoError(t, err)
+
+	expected := []string{"jlpt::n5", "lesson::2", "lesson::10", "jlpt", "lesson", "pos", "pos::verb", "pos::verb::godan"}
+	assert.Equal(t, expected, ts.Expand())
+}
+
+func TestTagSetRename(t *testing.T) {
+	tests := []struct {
+		name         string
+		tags         string
+		old          string
+		new          string
+		expectedTags string
+	}{
+		{
+			name:         "Renaming a flat tag",
+			tags:         "v 3",
+			old:          "v",
+			new:          "verb",
+			expectedTags: "3 verb",
+		},
+		{
+			name:         "Renaming a parent renames its subtree",
+			tags:         "pos::verb pos::verb::godan pos::noun",
+			old:          "pos::verb",
+			new:          "verb",
+			expectedTags: "pos::noun verb verb::godan",
+		},
+		{
+			name:         "Renaming only matches whole levels",
+			tags:         "pos::verbal",
+			old:          "pos::verb",
+			new:          "verb",
+			expectedTags: "pos::verbal",
+		},
+		{
+			name:         "Renaming into a child of itself",
+			tags:         "verb verb::godan",
+			old:          "verb",
+			new:          "pos::verb",
+			expectedTags: "pos::verb pos::verb::godan",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, err := NewTagSet(test.tags)
+			require.NoError(t, err)
+			ts.Rename(test.old, test.new)
+			assert.Equal(t, test.expectedTags, ts.ToString())
+		})
+	}
+}
+
+func TestTagSetToStringFlat(t *testing.T) {
+	ts, err := NewTagSet("pos::verb::godan jlpt::n5 3")
+	require.NoError(t, err)
+
+	assert.Equal(t, "3 jlpt::n5 pos::verb::godan", ts.ToString())
+	assert.Equal(t, "3 jlpt_n5 pos_verb_godan", ts.ToStringFlat("_"))
+}
@@ -0,0 +1,213 @@
+package types
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/romaji"
+	"github.com/pkg/errors"
+)
+
+// Matcher decides which entries are the same word, and so are merged,
+// and which redefine each other's terms.
+type Matcher interface {
+	// Key returns what identifies an entry: entries with the same key are
+	// the same word. They must have the same Japanese or English term too,
+	// so that merges can find them by sorting.
+	Key(e *Entry) string
+	// Terms returns the Japanese and English of an entry in the form
+	// they're compared in. Entries with a term in common but different
+	// keys redefine each other.
+	Terms(e *Entry) (japanese, english string)
+}
+
+// EntriesMatch reports whether two entries are the same word according to m.
+func EntriesMatch(m Matcher, e1, e2 *Entry) bool {
+	return m.Key(e1) == m.Key(e2)
+}
+
+// EntriesRedefinedBy reports whether two entries that don't match according
+// to m have a term in common, as m compares them. The text of the variants
+// merged into either entry is compared too.
+func EntriesRedefinedBy(m Matcher, e1, e2 *Entry) bool {
+	if EntriesMatch(m, e1, e2) {
+		return false
+	}
+	for _, t1 := range variantTerms(m, e1) {
+		for _, t2 := range variantTerms(m, e2) {
+			if t1.Japanese == t2.Japanese || t1.English == t2.English {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MergeMatching adds the tags and sources of an entry matching this one
+// according to m. Its text, and that of its variants, is added to the
+// entry's variants if m compares it differently to the entry's own, like
+// the English of entries matched by their Japanese alone.
+func (e *Entry) MergeMatching(m Matcher, source *Entry) error {
+	if !EntriesMatch(m, e, source) {
+		return errors.New("Cannot merge unequal entries")
+	}
+	terms := variantTerms(m, e)
+	for _, v := range source.variants() {
+		japanese, english := m.Terms(v.entry())
+		found := false
+		for _, t := range terms {
+			if t.Japanese == japanese && t.English == english {
+				found = true
+				break
+			}
+		}
+		if !found {
+			e.Variants = append(e.Variants, v)
+			terms = append(terms, Variant{Japanese: japanese, English: english})
+		}
+	}
+	for tag := range source.Tags.Tags {
+		e.Tags.Insert(tag)
+	}
+	e.Sources = append(e.Sources, source.Sources...)
+	return nil
+}
+
+// variantTerms returns the terms, as m compares them, of an entry's own
+// text followed by those of its variants.
+func variantTerms(m Matcher, e *Entry) []Variant {
+	var terms []Variant
+	for _, v := range e.variants() {
+		japanese, english := m.Terms(v.entry())
+		terms = append(terms, Variant{Japanese: japanese, English: english})
+	}
+	return terms
+}
+
+// fieldsMatcher matches entries by some of their fields, after changing
+// them to the form they're compared in.
+type fieldsMatcher struct {
+	japanese func(string) string
+	english  func(string) string
+	// byJapanese and byEnglish say which fields make up the key.
+	byJapanese bool
+	byEnglish  bool
+}
+
+func (m *fieldsMatcher) Terms(e *Entry) (string, string) {
+	return m.japanese(e.Japanese), m.english(e.English)
+}
+
+func (m *fieldsMatcher) Key(e *Entry) string {
+	japanese, english := m.Terms(e)
+	if !m.byJapanese {
+		japanese = ""
+	}
+	if !m.byEnglish {
+		english = ""
+	}
+	return japanese + "\x00" + english
+}
+
+func same(s string) string {
+	return s
+}
+
+var (
+	// ExactMatcher matches entries with exactly the same Japanese and English.
+	ExactMatcher Matcher = &fieldsMatcher{japanese: same, english: same, byJapanese: true, byEnglish: true}
+	// NormalizedMatcher matches entries whose Japanese and English only
+	// differ in spacing, full-width letters, the case of the English, or
+	// how glosses are separated.
+	NormalizedMatcher Matcher = &fieldsMatcher{japanese: normalize, english: normalizeEnglish, byJapanese: true, byEnglish: true}
+	// JapaneseMatcher matches entries by their Japanese alone, so entries
+	// with different English have their glosses merged.
+	JapaneseMatcher Matcher = &fieldsMatcher{japanese: same, english: same, byJapanese: true}
+	// EnglishMatcher matches entries by their English alone, so entries
+	// with different Japanese have it merged.
+	EnglishMatcher Matcher = &fieldsMatcher{japanese: same, english: same, byEnglish: true}
+	// ReadingMatcher matches entries whose Japanese reads the same in
+	// hiragana, katakana or romaji, like まち, マチ and machi, and whose
+	// English is the same.
+	ReadingMatcher Matcher = &fieldsMatcher{japanese: romaji.Key, english: same, byJapanese: true, byEnglish: true}
+)
+
+// Matchers are the built-in matchers by name.
+var Matchers = map[string]Matcher{
+	"exact":      ExactMatcher,
+	"normalized": NormalizedMatcher,
+	"japanese":   JapaneseMatcher,
+	"english":    EnglishMatcher,
+	"reading":    ReadingMatcher,
+}
+
+// ParseMatcher returns the built-in matcher with a name, such as japanese.
+func ParseMatcher(name string) (Matcher, error) {
+	if m, ok := Matchers[name]; ok {
+		return m, nil
+	}
+	var names []string
+	for n := range Matchers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, errors.Errorf("Unknown matcher %s, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// normalize folds full-width letters and spaces to ASCII and collapses
+// runs of spaces.
+func normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= '！' && r <= '～':
+			return r - 0xFEE0
+		case r == '　':
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// normalizeEnglish normalizes English, lower cases it, and separates its
+// glosses with " / ".
+func normalizeEnglish(s string) string {
+	var glosses []string
+	for _, gloss := range strings.FieldsFunc(strings.ToLower(normalize(s)), func(r rune) bool {
+		return r == '/' || r == ';'
+	}) {
+		if gloss = strings.TrimSpace(gloss); gloss != "" {
+			glosses = append(glosses, gloss)
+		}
+	}
+	return strings.Join(glosses, " / ")
+}
+
+// mergeGlosses adds the slash-separated glosses of b that a doesn't have
+// to a.
+func mergeGlosses(a, b string) string {
+	glosses := splitGlosses(a)
+	for _, gloss := range splitGlosses(b) {
+		found := false
+		for _, g := range glosses {
+			if g == gloss {
+				found = true
+				break
+			}
+		}
+		if !found {
+			glosses = append(glosses, gloss)
+		}
+	}
+	return strings.Join(glosses, " / ")
+}
+
+func splitGlosses(s string) []string {
+	var glosses []string
+	for _, gloss := range strings.Split(s, "/") {
+		if gloss = strings.TrimSpace(gloss); gloss != "" {
+			glosses = append(glosses, gloss)
+		}
+	}
+	return glosses
+}
@@ -0,0 +1,140 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMatcher(t *testing.T) {
+	m, err := ParseMatcher("japanese")
+	require.NoError(t, err)
+	assert.Equal(t, JapaneseMatcher, m)
+
+	_, err = ParseMatcher("loose")
+	assert.EqualError(t, err, "Unknown matcher loose, expected one of english, exact, japanese, normalized, reading")
+}
+
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		name      string
+		matcher   Matcher
+		a, b      *Entry
+		equal     bool
+		redefined bool
+	}{
+		{
+			name:    "Exact matches equal entries",
+			matcher: ExactMatcher,
+			a:       NewEntry(machi, "city / town", "1"),
+			b:       NewEntry(machi, "city / town", "2"),
+			equal:   true,
+		},
+		{
+			name:      "Exact redefines differing English",
+			matcher:   ExactMatcher,
+			a:         NewEntry(machi, "city", ""),
+			b:         NewEntry(machi, "town", ""),
+			redefined: true,
+		},
+		{
+			name:    "Normalized ignores case, spacing and gloss separators",
+			matcher: NormalizedMatcher,
+			a:       NewEntry("ＣＤ", "City;  Town", ""),
+			b:       NewEntry("CD", "city / town", ""),
+			equal:   true,
+		},
+		{
+			name:      "Normalized redefines differing English",
+			matcher:   NormalizedMatcher,
+			a:         NewEntry(machi, "City", ""),
+			b:         NewEntry(machi, "town", ""),
+			redefined: true,
+		},
+		{
+			name:    "Japanese ignores the English",
+			matcher: JapaneseMatcher,
+			a:       NewEntry(machi, "city", ""),
+			b:       NewEntry(machi, "town", ""),
+			equal:   true,
+		},
+		{
+			name:      "Japanese redefines differing Japanese with the same English",
+			matcher:   JapaneseMatcher,
+			a:         NewEntry("バスてい", "bus stop", ""),
+			b:         NewEntry("バスのりば", "bus stop", ""),
+			redefined: true,
+		},
+		{
+			name:    "English ignores the Japanese",
+			matcher: EnglishMatcher,
+			a:       NewEntry("バスてい", "bus stop", ""),
+			b:       NewEntry("バスのりば", "bus stop", ""),
+			equal:   true,
+		},
+		{
+			name:    "Reading treats kana and romaji alike",
+			matcher: ReadingMatcher,
+			a:       NewEntry("マチ", "town", ""),
+			b:       NewEntry("machi", "town", ""),
+			equal:   true,
+		},
+		{
+			name:      "Reading redefines differing English",
+			matcher:   ReadingMatcher,
+			a:         NewEntry("マチ", "city", ""),
+			b:         NewEntry(machi, "town", ""),
+			redefined: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.equal, EntriesMatch(test.matcher, test.a, test.b))
+			assert.Equal(t, test.redefined, EntriesRedefinedBy(test.matcher, test.a, test.b))
+		})
+	}
+}
+
+func TestMergeMatchingKeepsVariants(t *testing.T) {
+	e := NewEntry(machi, "town / street", "1")
+	require.NoError(t, e.MergeMatching(JapaneseMatcher, NewEntry(machi, "city / town", "2")))
+	require.NoError(t, e.MergeMatching(JapaneseMatcher, NewEntry(machi, "city / town", "3")))
+	assert.Equal(t, "town / street", e.English)
+	assert.Equal(t, []Variant{{Japanese: machi, English: "city / town"}}, e.Variants)
+	assert.Equal(t, "1 2 3", e.Tags.ToString())
+
+	// Glosses are combined in the same order whichever entry was kept.
+	japanese, english := e.Text()
+	assert.Equal(t, machi, japanese)
+	assert.Equal(t, "city / town / street", english)
+	other := NewEntry(machi, "city / town", "2")
+	require.NoError(t, other.MergeMatching(JapaneseMatcher, NewEntry(machi, "town / street", "1")))
+	_, otherEnglish := other.Text()
+	assert.Equal(t, english, otherEnglish)
+
+	e = NewEntry("バスてい", "bus stop", "1")
+	require.NoError(t, e.MergeMatching(EnglishMatcher, NewEntry("バスのりば", "bus stop", "1")))
+	japanese, _ = e.Text()
+	assert.Equal(t, "バスてい / バスのりば", japanese)
+
+	// Text only differing as the matcher ignores isn't a variant.
+	e = NewEntry("ＣＤ", "City", "")
+	require.NoError(t, e.MergeMatching(NormalizedMatcher, NewEntry("CD", "city", "")))
+	assert.Empty(t, e.Variants)
+
+	assert.Error(t, e.MergeMatching(ExactMatcher, NewEntry("CD", "city", "")))
+}
+
+func TestRedefinedByVariant(t *testing.T) {
+	machiTown := NewEntry(machi, "town", "")
+	require.NoError(t, machiTown.MergeMatching(JapaneseMatcher, NewEntry(machi, "city", "")))
+	mura := NewEntry("むら", "town", "")
+	assert.True(t, EntriesRedefinedBy(JapaneseMatcher, mura, machiTown))
+
+	machiCity := NewEntry(machi, "city", "")
+	require.NoError(t, machiCity.MergeMatching(JapaneseMatcher, NewEntry(machi, "town", "")))
+	assert.True(t, EntriesRedefinedBy(JapaneseMatcher, mura, machiCity))
+	assert.False(t, EntriesRedefinedBy(JapaneseMatcher, NewEntry("むら", "village", ""), machiCity))
+}
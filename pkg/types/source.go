@@ -0,0 +1,123 @@
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Source records a line an Entry was loaded from, and the tags that line contributed.
+type Source struct {
+	File string
+	Line int
+	Tags []string
+}
+
+// sourceRegexp matches a single formatted Source, like lesson1.csv:3=1 2.
+// Colons in the file name are escaped, while tags may contain them.
+var sourceRegexp = regexp.MustCompile(`^([^:]*):(\d+)(?:=(.*))?$`)
+
+// escapes are the characters escaped in the file names of formatted
+// sources and the text of formatted variants, along with control characters
+// such as tabs: those separating the parts of a source and sources from each
+// other, the comma and quote of comma-separated fields, and the escape
+// character itself.
+const escapes = "%:=;,\""
+
+// escape escapes the characters of a file name, or the text of a variant,
+// that would stop it from being parsed once formatted, as %XX.
+func escape(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < ' ' || strings.IndexByte(escapes, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// Location returns the file and line of the Source, as file:line.
+func (s Source) Location() string {
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// String returns the Source as file:line=tags, with the tags space-separated.
+// Characters of the file name that separate the parts of sources are escaped.
+func (s Source) String() string {
+	location := fmt.Sprintf("%s:%d", escape(s.File), s.Line)
+	if len(s.Tags) == 0 {
+		return location
+	}
+	return fmt.Sprintf("%s=%s", location, strings.Join(s.Tags, " "))
+}
+
+// Locations returns the locations of all sources, separated by commas.
+func Locations(sources []Source) string {
+	locs := make([]string, len(sources))
+	for i, s := range sources {
+		locs[i] = s.Location()
+	}
+	return strings.Join(locs, ", ")
+}
+
+// SourcesInFiles returns the sources from any of the files others came from,
+// such as the earlier lines of the file an entry was repeated in.
+func SourcesInFiles(sources, others []Source) []Source {
+	files := make(map[string]bool)
+	for _, o := range others {
+		files[o.File] = true
+	}
+	var found []Source
+	for _, s := range sources {
+		if files[s.File] {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// FormatSources returns sources as a single string, separated by semicolons.
+func FormatSources(sources []Source) string {
+	strs := make([]string, len(sources))
+	for i, s := range sources {
+		strs[i] = s.String()
+	}
+	return strings.Join(strs, ";")
+}
+
+// ParseSources parses a string created by FormatSources.
+func ParseSources(str string) ([]Source, error) {
+	var sources []Source
+	for _, part := range strings.Split(str, ";") {
+		if part == "" {
+			continue
+		}
+		m := sourceRegexp.FindStringSubmatch(part)
+		if m == nil {
+			return nil, errors.Errorf("Invalid source %s", part)
+		}
+		name, err := url.PathUnescape(m[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid file name in source %s", part)
+		}
+		line, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid line number in source %s", part)
+		}
+		var tags []string
+		for _, tag := range strings.Split(m[3], " ") {
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		sources = append(sources, Source{File: name, Line: line, Tags: tags})
+	}
+	return sources, nil
+}
@@ -0,0 +1,80 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatSources(t *testing.T) {
+	tests := []struct {
+		name        string
+		sources     []Source
+		expectedStr string
+	}{
+		{
+			name:        "No sources",
+			sources:     nil,
+			expectedStr: "",
+		},
+		{
+			name:        "Source without tags",
+			sources:     []Source{{File: "lesson1.csv", Line: 3}},
+			expectedStr: "lesson1.csv:3",
+		},
+		{
+			name: "Multiple sources with tags",
+			sources: []Source{
+				{File: "lesson1.csv", Line: 3, Tags: []string{"1", "2"}},
+				{File: "lessons/jlpt.csv", Line: 12, Tags: []string{"jlpt::n5"}},
+			},
+			expectedStr: "lesson1.csv:3=1 2;lessons/jlpt.csv:12=jlpt::n5",
+		},
+		{
+			name:        "File names are escaped",
+			sources:     []Source{{File: "a;b=c:d,e%f.csv", Line: 3, Tags: []string{"1"}}},
+			expectedStr: "a%3Bb%3Dc%3Ad%2Ce%25f.csv:3=1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			str := FormatSources(test.sources)
+			assert.Equal(t, test.expectedStr, str)
+
+			parsed, err := ParseSources(str)
+			assert.NoError(t, err)
+			assert.Equal(t, test.sources, parsed)
+		})
+	}
+}
+
+func TestParseSourcesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+	}{
+		{name: "Missing line number", str: "lesson1.csv"},
+		{name: "Line number isn't a number", str: "lesson1.csv:three=1"},
+		{name: "Invalid escape in file name", str: "lesson%zz.csv:3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseSources(test.str)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSourcesInFiles(t *testing.T) {
+	sources := []Source{
+		{File: "a.csv", Line: 1},
+		{File: "b.csv", Line: 4},
+		{File: "a.csv", Line: 7},
+	}
+	assert.Equal(t, []Source{{File: "a.csv", Line: 1}, {File: "a.csv", Line: 7}},
+		SourcesInFiles(sources, []Source{{File: "a.csv", Line: 9}}))
+	assert.Empty(t, SourcesInFiles(sources, []Source{{File: "c.csv", Line: 1}}))
+	assert.Empty(t, SourcesInFiles(sources, nil))
+}
@@ -4,26 +4,52 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
+// TagOrder is an order tags can be sorted in.
+type TagOrder int
+
+const (
+	// NaturalOrder compares numbers within tags numerically, so 2 comes
+	// before 10 and L2 before L10. Tags without any digits come last.
+	NaturalOrder TagOrder = iota
+	// LexicalOrder compares tags as plain strings, so 10 comes before 2.
+	LexicalOrder
+)
+
+// ParseTagOrder returns the TagOrder with the given name, natural or lexical.
+func ParseTagOrder(name string) (TagOrder, error) {
+	switch name {
+	case "natural":
+		return NaturalOrder, nil
+	case "lexical":
+		return LexicalOrder, nil
+	}
+	return 0, errors.Errorf("Unknown tag order %s, expected natural or lexical", name)
+}
+
 // TagSet is a set of strings representing unique tags. Tags are not
 // guarunteed to be sorted unless retrieved via the Sort method.
 type TagSet struct {
 	Tags map[string]bool
 }
 
+// TagRewriter rewrites tags, such as the tag rules applied as decks are
+// read. Rewrite returns the tag to use in place of tag, or false if the tag
+// should be dropped.
+type TagRewriter interface {
+	Rewrite(tag string) (string, bool)
+}
+
 // NewTagSet returns a TagSet with the provided tags.
 // If the provided string has spaces, tags will be created by splitting on spaces.
 // The emptry string will result in an empty TagSet.
 func NewTagSet(tags string) (*TagSet, error) {
-	actualTags := strings.Split(tags, " ")
-	tagMap := make(map[string]bool)
-	for _, tag := range actualTags {
-		if tag != "" {
-			tagMap[tag] = true
-		}
-	}
-	return &TagSet{Tags: tagMap}, nil
+	ts := &TagSet{Tags: make(map[string]bool)}
+	ts.Insert(tags)
+	return ts, nil
 }
 
 // Insert inserts one or more tags into the TagSet.
@@ -31,18 +57,47 @@ func NewTagSet(tags string) (*TagSet, error) {
 func (ts *TagSet) Insert(tags string) {
 	actualTags := strings.Split(tags, " ")
 	for _, tag := range actualTags {
-		if tag != "" {
-			ts.Tags[tag] = true
+		if tag == "" {
+			continue
 		}
+		ts.Tags[tag] = true
 	}
 }
 
-// ToString returns the tags in a TagSet as a single, space-separated string.
+// Rewrite replaces every tag in the TagSet with the tag rw rewrites it to,
+// dropping those it removes. Rewriting a tag twice may not give the same
+// tag, so tags should only be rewritten once.
+func (ts *TagSet) Rewrite(rw TagRewriter) {
+	rewritten := make(map[string]bool)
+	for tag := range ts.Tags {
+		if t, ok := rw.Rewrite(tag); ok && t != "" {
+			rewritten[t] = true
+		}
+	}
+	ts.Tags = rewritten
+}
+
+// ToString returns the tags in a TagSet as a single, space-separated string,
+// in NaturalOrder.
 func (ts *TagSet) ToString() string {
+	return joinTags(ts.SortNatural())
+}
+
+// ToStringOrdered returns the tags in a TagSet like ToString, in the given order.
+func (ts *TagSet) ToStringOrdered(order TagOrder) string {
+	return joinTags(ts.Ordered(order))
+}
+
+// ToStringFlat returns the tags in a TagSet like ToString, but with
+// hierarchical tags flattened by joining their levels with sep.
+func (ts *TagSet) ToStringFlat(sep string) string {
+	return ts.Flatten(sep).ToString()
+}
+
+func joinTags(tags []string) string {
 	var b strings.Builder
-	entries := ts.Sort()
-	for _, entry := range entries {
-		fmt.Fprintf(&b, "%s ", entry)
+	for _, tag := range tags {
+		fmt.Fprintf(&b, "%s ", tag)
 	}
 	return strings.TrimSpace(b.String())
 }
@@ -57,3 +112,144 @@ func (ts *TagSet) Sort() []string {
 	sort.Strings(sorted)
 	return sorted
 }
+
+// SortNatural returns the tags in a TagSet as a slice of strings in NaturalOrder.
+func (ts *TagSet) SortNatural() []string {
+	sorted := ts.Sort()
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return NaturalLess(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+// Ordered returns the tags in a TagSet as a slice of strings in the given order.
+func (ts *TagSet) Ordered(order TagOrder) []string {
+	if order == LexicalOrder {
+		return ts.Sort()
+	}
+	return ts.SortNatural()
+}
+
+// NaturalLess reports whether tag a comes before tag b in NaturalOrder.
+func NaturalLess(a, b string) bool {
+	aDigits, bDigits := strings.IndexFunc(a, isDigit) >= 0, strings.IndexFunc(b, isDigit) >= 0
+	if aDigits != bDigits {
+		return aDigits
+	}
+
+	aChunks, bChunks := naturalChunks(a), naturalChunks(b)
+	for i := 0; i < len(aChunks) && i < len(bChunks); i++ {
+		ac, bc := aChunks[i], bChunks[i]
+		aNum, bNum := isDigits(ac), isDigits(bc)
+		switch {
+		case aNum && bNum:
+			// Compare numerically without parsing, so long numbers can't overflow.
+			at, bt := strings.TrimLeft(ac, "0"), strings.TrimLeft(bc, "0")
+			if len(at) != len(bt) {
+				return len(at) < len(bt)
+			}
+			if at != bt {
+				return at < bt
+			}
+		case aNum != bNum:
+			return aNum
+		case ac != bc:
+			return ac < bc
+		}
+	}
+	if len(aChunks) != len(bChunks) {
+		return len(aChunks) < len(bChunks)
+	}
+	// Equal apart from leading zeros, like 3 and 03.
+	return a < b
+}
+
+// naturalChunks splits a string into runs of digits and runs of anything else.
+func naturalChunks(s string) []string {
+	var chunks []string
+	start := 0
+	for i, r := range s {
+		if i > start && isDigit(r) != isDigits(s[start:i]) {
+			chunks = append(chunks, s[start:i])
+			start = i
+		}
+	}
+	if start < len(s) {
+		chunks = append(chunks, s[start:])
+	}
+	return chunks
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !isDigit(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// Contains reports whether the TagSet has exactly this tag. Unlike Has,
+// parents aren't implied by their children.
+func (ts *TagSet) Contains(tag string) bool {
+	return ts.Tags[tag]
+}
+
+// Remove removes one or more tags from the TagSet.
+// Strings with spaces will be split on the spaces.
+func (ts *TagSet) Remove(tags string) {
+	for _, tag := range strings.Split(tags, " ") {
+		delete(ts.Tags, tag)
+	}
+}
+
+// Union returns a new TagSet with the tags in either TagSet.
+func (ts *TagSet) Union(other *TagSet) *TagSet {
+	union := make(map[string]bool, len(ts.Tags)+len(other.Tags))
+	for tag := range ts.Tags {
+		union[tag] = true
+	}
+	for tag := range other.Tags {
+		union[tag] = true
+	}
+	return &TagSet{Tags: union}
+}
+
+// Intersect returns a new TagSet with the tags in both TagSets.
+func (ts *TagSet) Intersect(other *TagSet) *TagSet {
+	intersection := make(map[string]bool)
+	for tag := range ts.Tags {
+		if other.Tags[tag] {
+			intersection[tag] = true
+		}
+	}
+	return &TagSet{Tags: intersection}
+}
+
+// Difference returns a new TagSet with the tags in this TagSet that aren't in other.
+func (ts *TagSet) Difference(other *TagSet) *TagSet {
+	difference := make(map[string]bool)
+	for tag := range ts.Tags {
+		if !other.Tags[tag] {
+			difference[tag] = true
+		}
+	}
+	return &TagSet{Tags: difference}
+}
+
+// Equal reports whether both TagSets have exactly the same tags.
+func (ts *TagSet) Equal(other *TagSet) bool {
+	if len(ts.Tags) != len(other.Tags) {
+		return false
+	}
+	for tag := range ts.Tags {
+		if !other.Tags[tag] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -96,6 +97,11 @@ func TestTagSetToString(t *testing.T) {
 			tagSet:      &TagSet{Tags: map[string]bool{"22": true, "12": true, "1": true}},
 			expectedStr: "1 12 22",
 		},
+		{
+			name:        "String output is in natural order by default",
+			tagSet:      &TagSet{Tags: map[string]bool{"20": true, "2": true, "5": true, "10": true, "1": true}},
+			expectedStr: "1 2 5 10 20",
+		},
 	}
 
 	for _, test := range tests {
@@ -138,3 +144,144 @@ func TestTagSetSort(t *testing.T) {
 		})
 	}
 }
+
+func TestTagSetToStringOrdered(t *testing.T) {
+	ts, err := NewTagSet("20 2 5 10 1")
+	require.NoError(t, err)
+	assert.Equal(t, "1 10 2 20 5", ts.ToStringOrdered(LexicalOrder))
+	assert.Equal(t, "1 2 5 10 20", ts.ToStringOrdered(NaturalOrder))
+}
+
+func TestTagSetSortNatural(t *testing.T) {
+	tests := []struct {
+		name          string
+		tags          string
+		expectedOrder []string
+	}{
+		{
+			name:          "Numbers are compared numerically",
+			tags:          "1 10 2 20 5",
+			expectedOrder: []string{"1", "2", "5", "10", "20"},
+		},
+		{
+			name:          "Numbers within tags are compared numerically",
+			tags:          "L10 L2 L1",
+			expectedOrder: []string{"L1", "L2", "L10"},
+		},
+		{
+			name:          "Tags without numbers come last",
+			tags:          "verb L2 noun 3",
+			expectedOrder: []string{"3", "L2", "noun", "verb"},
+		},
+		{
+			name:          "Leading zeros don't change the order",
+			tags:          "lesson::10 lesson::03 lesson::2",
+			expectedOrder: []string{"lesson::2", "lesson::03", "lesson::10"},
+		},
+		{
+			name:          "Numbers longer than an int still sort",
+			tags:          "123456789012345678901 99",
+			expectedOrder: []string{"99", "123456789012345678901"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, err := NewTagSet(test.tags)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedOrder, ts.SortNatural())
+		})
+	}
+}
+
+func TestParseTagOrder(t *testing.T) {
+	order, err := ParseTagOrder("lexical")
+	require.NoError(t, err)
+	assert.Equal(t, LexicalOrder, order)
+
+	order, err = ParseTagOrder("natural")
+	require.NoError(t, err)
+	assert.Equal(t, NaturalOrder, order)
+
+	_, err = ParseTagOrder("numeric")
+	assert.Error(t, err)
+}
+
+// upperRewriter upper cases tags, and drops the tag "drop".
+type upperRewriter struct{}
+
+func (upperRewriter) Rewrite(tag string) (string, bool) {
+	return strings.ToUpper(tag), tag != "drop"
+}
+
+func TestTagSetRewrite(t *testing.T) {
+	ts, err := NewTagSet("verb drop")
+	require.NoError(t, err)
+	ts.Rewrite(upperRewriter{})
+	assert.Equal(t, &TagSet{Tags: map[string]bool{"VERB": true}}, ts)
+
+	ts.Insert("noun drop")
+	assert.Equal(t, &TagSet{Tags: map[string]bool{"VERB": true, "noun": true, "drop": true}}, ts)
+}
+
+func TestTagSetAlgebra(t *testing.T) {
+	tagSet := func(tags string) *TagSet {
+		ts, err := NewTagSet(tags)
+		require.NoError(t, err)
+		return ts
+	}
+
+	tests := []struct {
+		name     string
+		op       func(a, b *TagSet) *TagSet
+		a        string
+		b        string
+		expected string
+	}{
+		{name: "Union", op: (*TagSet).Union, a: "1 2", b: "2 3", expected: "1 2 3"},
+		{name: "Union with empty", op: (*TagSet).Union, a: "1 2", b: "", expected: "1 2"},
+		{name: "Intersect", op: (*TagSet).Intersect, a: "1 2", b: "2 3", expected: "2"},
+		{name: "Disjoint intersect", op: (*TagSet).Intersect, a: "1", b: "2", expected: ""},
+		{name: "Difference", op: (*TagSet).Difference, a: "1 2", b: "2 3", expected: "1"},
+		{name: "Difference with empty", op: (*TagSet).Difference, a: "1 2", b: "", expected: "1 2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := tagSet(test.a), tagSet(test.b)
+			actual := test.op(a, b)
+			assert.Equal(t, tagSet(test.expected), actual)
+			// Operands are left alone.
+			assert.Equal(t, tagSet(test.a), a)
+			assert.Equal(t, tagSet(test.b), b)
+		})
+	}
+}
+
+func TestTagSetContainsAndRemove(t *testing.T) {
+	ts, err := NewTagSet("1 2 jlpt::n5")
+	require.NoError(t, err)
+
+	assert.True(t, ts.Contains("1"))
+	assert.True(t, ts.Contains("jlpt::n5"))
+	assert.False(t, ts.Contains("jlpt"))
+
+	ts.Remove("1 jlpt::n5 missing")
+	assert.Equal(t, &TagSet{Tags: map[string]bool{"2": true}}, ts)
+}
+
+func TestTagSetEqual(t *testing.T) {
+	a, err := NewTagSet("1 2")
+	require.NoError(t, err)
+	b, err := NewTagSet("2 1")
+	require.NoError(t, err)
+	c, err := NewTagSet("1 3")
+	require.NoError(t, err)
+	d, err := NewTagSet("1")
+	require.NoError(t, err)
+
+	assert.True(t, a.Equal(b))
+	assert.False(t, a.Equal(c))
+	assert.False(t, a.Equal(d))
+	assert.False(t, d.Equal(a))
+}
@@ -0,0 +1,63 @@
+package types
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Variant is the Japanese and English of an entry merged into another.
+type Variant struct {
+	Japanese string
+	English  string
+}
+
+// variants returns the entry's own text followed by its variants.
+func (e *Entry) variants() []Variant {
+	return append([]Variant{{Japanese: e.Japanese, English: e.English}}, e.Variants...)
+}
+
+// entry returns an entry with the variant's text, for matchers to compare.
+func (v Variant) entry() *Entry {
+	return &Entry{Japanese: v.Japanese, English: v.English}
+}
+
+// String returns the Variant as japanese=english, with characters that
+// separate variants escaped.
+func (v Variant) String() string {
+	return escape(v.Japanese) + "=" + escape(v.English)
+}
+
+// FormatVariants returns variants as a single string, separated by semicolons.
+func FormatVariants(variants []Variant) string {
+	strs := make([]string, len(variants))
+	for i, v := range variants {
+		strs[i] = v.String()
+	}
+	return strings.Join(strs, ";")
+}
+
+// ParseVariants parses a string created by FormatVariants.
+func ParseVariants(str string) ([]Variant, error) {
+	var variants []Variant
+	for _, part := range strings.Split(str, ";") {
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, "=")
+		if len(fields) != 2 {
+			return nil, errors.Errorf("Invalid variant %s", part)
+		}
+		japanese, err := url.PathUnescape(fields[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid Japanese in variant %s", part)
+		}
+		english, err := url.PathUnescape(fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid English in variant %s", part)
+		}
+		variants = append(variants, Variant{Japanese: japanese, English: english})
+	}
+	return variants, nil
+}
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatVariants(t *testing.T) {
+	variants := []Variant{
+		{Japanese: machi, English: "city / town"},
+		{Japanese: "はい、どうぞ", English: `"yes, please"; here=you go`},
+	}
+	str := FormatVariants(variants)
+	assert.Equal(t, "まち=city / town;はい、どうぞ=%22yes%2C please%22%3B here%3Dyou go", str)
+
+	parsed, err := ParseVariants(str)
+	require.NoError(t, err)
+	assert.Equal(t, variants, parsed)
+
+	parsed, err = ParseVariants("")
+	require.NoError(t, err)
+	assert.Empty(t, parsed)
+
+	_, err = ParseVariants("まち")
+	assert.Error(t, err)
+}
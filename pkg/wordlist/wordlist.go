@@ -0,0 +1,204 @@
+// Package wordlist tags entries from lists of words, such as the words of
+// a JLPT level or a list of the most frequent words.
+package wordlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/romaji"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// The IDs of the problems Enrich finds.
+const (
+	NoMatchRule        = "no-match"
+	MultipleLevelsRule = "multiple-levels"
+)
+
+// Rules describes the problems Enrich finds.
+var Rules = []diagnostic.Rule{
+	{ID: NoMatchRule, Description: "the Japanese isn't in any word list or the frequency list"},
+	{ID: MultipleLevelsRule, Description: "the Japanese is in more than one word list"},
+}
+
+// readWords calls add with the word on each line of r, along with its
+// position among the words, starting at 1. The word is the first
+// tab-separated field of a line, so lists can have readings or meanings
+// after it. Empty lines and lines starting with # are skipped.
+func readWords(r io.Reader, add func(word string, rank int)) error {
+	scanner := bufio.NewScanner(r)
+	rank := 0
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		word := strings.TrimSpace(strings.SplitN(text, "\t", 2)[0])
+		if word == "" {
+			continue
+		}
+		rank++
+		add(romaji.Key(word), rank)
+	}
+	return errors.Wrap(scanner.Err(), "Error reading word list")
+}
+
+// open opens a list, which may be compressed.
+func open(path string, read func(io.Reader) error) error {
+	rc, err := file.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Couldn't open word list %s", path)
+	}
+	defer rc.Close()
+	return errors.Wrapf(read(rc), "Error with word list %s", path)
+}
+
+// List is a list of words, whose entries get a tag.
+type List struct {
+	Tag   string
+	words map[string]bool
+}
+
+// ParseList reads a list of words, one per line, to tag with tag. Hiragana,
+// katakana and romaji are treated alike.
+func ParseList(r io.Reader, tag string) (*List, error) {
+	l := &List{Tag: tag, words: make(map[string]bool)}
+	err := readWords(r, func(word string, rank int) { l.words[word] = true })
+	return l, err
+}
+
+// LoadList loads a list of words from a file. See ParseList for the format.
+func LoadList(path, tag string) (*List, error) {
+	var l *List
+	err := open(path, func(r io.Reader) (err error) {
+		l, err = ParseList(r, tag)
+		return err
+	})
+	return l, err
+}
+
+// Contains reports whether the list has a word.
+func (l *List) Contains(word string) bool {
+	return l.words[romaji.Key(word)]
+}
+
+// Frequency ranks words by how often they're used.
+type Frequency struct {
+	ranks map[string]int
+}
+
+// ParseFrequency reads a list of words, one per line, most frequent first.
+// Only a word's first line counts.
+func ParseFrequency(r io.Reader) (*Frequency, error) {
+	f := &Frequency{ranks: make(map[string]int)}
+	err := readWords(r, func(word string, rank int) {
+		if _, ok := f.ranks[word]; !ok {
+			f.ranks[word] = rank
+		}
+	})
+	return f, err
+}
+
+// LoadFrequency loads a frequency list from a file. See ParseFrequency for
+// the format.
+func LoadFrequency(path string) (*Frequency, error) {
+	var f *Frequency
+	err := open(path, func(r io.Reader) (err error) {
+		f, err = ParseFrequency(r)
+		return err
+	})
+	return f, err
+}
+
+// Rank returns the rank of a word, 1 for the most frequent, and false if
+// it isn't on the list.
+func (f *Frequency) Rank(word string) (int, bool) {
+	rank, ok := f.ranks[romaji.Key(word)]
+	return rank, ok
+}
+
+// Bands groups frequency ranks. Each band is the highest rank in it, so
+// 1000,5000 puts ranks 1 to 1000 in band 1000 and 1001 to 5000 in 5000.
+type Bands []int
+
+// ParseBands parses a comma-separated list of bands, like 1000,5000.
+func ParseBands(s string) (Bands, error) {
+	var bands Bands
+	for _, field := range strings.Split(s, ",") {
+		band, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || band < 1 {
+			return nil, errors.Errorf("Invalid frequency band %q, expected a positive number", field)
+		}
+		bands = append(bands, band)
+	}
+	sort.Ints(bands)
+	return bands, nil
+}
+
+// Band returns the band of a rank, and false if it's lower than all of them.
+func (b Bands) Band(rank int) (int, bool) {
+	for _, band := range b {
+		if rank <= band {
+			return band, true
+		}
+	}
+	return 0, false
+}
+
+// Enricher tags entries from word lists and a frequency list.
+type Enricher struct {
+	Lists []*List
+	// Frequency, if set, tags entries with their frequency band, as
+	// FrequencyTag::BAND.
+	Frequency    *Frequency
+	Bands        Bands
+	FrequencyTag string
+}
+
+// Enrich adds the tags of each list an entry's Japanese is on, and its
+// frequency band, and returns the problems found: the entry being on no
+// list, or on several word lists.
+func (en *Enricher) Enrich(e *types.Entry) []diagnostic.Diagnostic {
+	var levels []string
+	for _, l := range en.Lists {
+		if l.Contains(e.Japanese) {
+			e.Tags.Insert(l.Tag)
+			levels = append(levels, l.Tag)
+		}
+	}
+	ranked := false
+	if en.Frequency != nil {
+		var rank int
+		if rank, ranked = en.Frequency.Rank(e.Japanese); ranked {
+			if band, ok := en.Bands.Band(rank); ok {
+				e.Tags.Insert(fmt.Sprintf("%s::%d", en.FrequencyTag, band))
+			}
+		}
+	}
+
+	switch {
+	case len(levels) == 0 && !ranked:
+		return []diagnostic.Diagnostic{{
+			Location: diagnostic.FirstLocation(e.Sources),
+			Rule:     NoMatchRule,
+			Level:    diagnostic.Note,
+			Message:  fmt.Sprintf("%s isn't on any list", e.Japanese),
+		}}
+	case len(levels) > 1:
+		return []diagnostic.Diagnostic{{
+			Location: diagnostic.FirstLocation(e.Sources),
+			Rule:     MultipleLevelsRule,
+			Level:    diagnostic.Warning,
+			Message:  fmt.Sprintf("%s is on several lists: %s", e.Japanese, strings.Join(levels, ", ")),
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package wordlist
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nrb/csvmerger/pkg/diagnostic"
+	"github.com/nrb/csvmerger/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseList(t *testing.T) {
+	l, err := ParseList(strings.NewReader("# JLPT N5\nまち\tmachi\ttown\n\nテレビ\n食べる\n"), "jlpt::n5")
+	require.NoError(t, err)
+	assert.Equal(t, "jlpt::n5", l.Tag)
+	for _, word := range []string{"まち", "マチ", "machi", "てれび", "食べる"} {
+		assert.True(t, l.Contains(word), word)
+	}
+	assert.False(t, l.Contains("town"))
+	assert.False(t, l.Contains("JLPT N5"))
+}
+
+func TestFrequencyRank(t *testing.T) {
+	f, err := ParseFrequency(strings.NewReader("の\nまち\tcity\nの\nテレビ\n"))
+	require.NoError(t, err)
+	rank, ok := f.Rank("まち")
+	assert.True(t, ok)
+	assert.Equal(t, 2, rank)
+	rank, ok = f.Rank("テレビ")
+	assert.True(t, ok)
+	assert.Equal(t, 4, rank)
+	_, ok = f.Rank("じんじゃ")
+	assert.False(t, ok)
+}
+
+func TestBands(t *testing.T) {
+	bands, err := ParseBands("5000, 1000")
+	require.NoError(t, err)
+	assert.Equal(t, Bands{1000, 5000}, bands)
+
+	tests := []struct {
+		rank         int
+		expectedBand int
+		expectedOk   bool
+	}{
+		{rank: 1, expectedBand: 1000, expectedOk: true},
+		{rank: 1000, expectedBand: 1000, expectedOk: true},
+		{rank: 1001, expectedBand: 5000, expectedOk: true},
+		{rank: 5001},
+	}
+	for _, test := range tests {
+		band, ok := bands.Band(test.rank)
+		assert.Equal(t, test.expectedBand, band, "rank %d", test.rank)
+		assert.Equal(t, test.expectedOk, ok, "rank %d", test.rank)
+	}
+
+	_, err = ParseBands("1000,many")
+	assert.Error(t, err)
+	_, err = ParseBands("0")
+	assert.Error(t, err)
+}
+
+func TestEnrich(t *testing.T) {
+	n5, err := ParseList(strings.NewReader("まち\nたべる\n"), "jlpt::n5")
+	require.NoError(t, err)
+	n4, err := ParseList(strings.NewReader("たべる\nしずか\n"), "jlpt::n4")
+	require.NoError(t, err)
+	freq, err := ParseFrequency(strings.NewReader("たべる\nまち\nじんじゃ\n"))
+	require.NoError(t, err)
+	en := &Enricher{Lists: []*List{n5, n4}, Frequency: freq, Bands: Bands{2}, FrequencyTag: "freq"}
+
+	tests := []struct {
+		name             string
+		entry            *types.Entry
+		expectedTags     string
+		expectedProblems []diagnostic.Diagnostic
+	}{
+		{
+			name:         "Levels and frequency bands are tagged",
+			entry:        types.NewEntry("まち", "city / town", "1"),
+			expectedTags: "1 freq::2 jlpt::n5",
+		},
+		{
+			name:         "Ranks below every band aren't tagged",
+			entry:        types.NewEntry("じんじゃ", "shrine", "1"),
+			expectedTags: "1",
+		},
+		{
+			name:         "Several levels are reported",
+			entry:        types.NewEntry("たべる", "to eat", ""),
+			expectedTags: "freq::2 jlpt::n4 jlpt::n5",
+			expectedProblems: []diagnostic.Diagnostic{{
+				Rule:    MultipleLevelsRule,
+				Level:   diagnostic.Warning,
+				Message: "たべる is on several lists: jlpt::n5, jlpt::n4",
+			}},
+		},
+		{
+			name:         "Entries on no list are reported",
+			entry:        types.NewEntry("うち", "house / home", "2"),
+			expectedTags: "2",
+			expectedProblems: []diagnostic.Diagnostic{{
+				Rule:    NoMatchRule,
+				Level:   diagnostic.Note,
+				Message: "うち isn't on any list",
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectedProblems, en.Enrich(test.entry))
+			assert.Equal(t, test.expectedTags, test.entry.Tags.ToString())
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"runtime"
+
+	"github.com/nrb/csvmerger/pkg/entries"
+	"github.com/nrb/csvmerger/pkg/stream"
+	"github.com/nrb/csvmerger/pkg/types"
+)
+
+// deckOperation runs a set operation, like intersect, on two decks. Each deck
+// is a single argument, which can be a directory or glob to merge several files.
+func deckOperation(name string, op func(m types.Matcher, a, b []*types.Entry) []*types.Entry, args []string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	output := addOutputFlags(flags)
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		log.Fatalf("%s needs exactly 2 decks", name)
+	}
+	a := input.loadMerged(flags.Args()[:1], match.matcher, *jobs)
+	b := input.loadMerged(flags.Args()[1:], match.matcher, *jobs)
+	output.write(stream.Slice(op(match.matcher, a, b)))
+}
+
+// intersect writes the entries present in both decks.
+func intersect(args []string) {
+	deckOperation("intersect", entries.Intersect, args)
+}
+
+// subtract writes the entries of the first deck that aren't in the second.
+func subtract(args []string) {
+	deckOperation("subtract", entries.Subtract, args)
+}
+
+// symdiff writes the entries present in only one of the decks.
+func symdiff(args []string) {
+	deckOperation("symdiff", entries.SymmetricDifference, args)
+}
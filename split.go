@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/nrb/csvmerger/pkg/entries"
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/stream"
+	"github.com/nrb/csvmerger/pkg/types"
+)
+
+// split writes one deck per tag matching a pattern, such as one per lesson.
+func split(args []string) {
+	flags := flag.NewFlagSet("split", flag.ExitOnError)
+	byTag := flags.String("by-tag", "", "wildcard pattern of the tags to split by, like 'lesson::*'")
+	outDir := flags.String("out", ".", "directory to write the decks to")
+	lowest := flags.Bool("lowest", false, "only put entries with several matching tags in the deck for the lowest one")
+	untagged := flags.String("untagged", "untagged", "name of the deck for entries without a matching tag")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	format := addFormatFlags(flags)
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if *byTag == "" {
+		log.Fatalf("Need a -by-tag pattern")
+	}
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file to split")
+	}
+
+	files, opts := input.expand(flags.Args())
+	merged := mergeFiles(files, opts, match.matcher, *jobs)
+	groups, unmatched, err := entries.SplitByTag(merged, *byTag, *lowest)
+	if err != nil {
+		log.Fatalf("Error splitting: %s", err)
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatalf("Error creating %s: %s", *outDir, err)
+	}
+	ext := deckExtension(files[0])
+	tags := make([]string, 0, len(groups))
+	for tag := range groups {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return types.NaturalLess(tags[i], tags[j]) })
+	for _, tag := range tags {
+		format.writeFile(filepath.Join(*outDir, safeFileName(tag)+ext), stream.Slice(groups[tag]))
+	}
+	if len(unmatched) > 0 {
+		format.writeFile(filepath.Join(*outDir, safeFileName(*untagged)+ext), stream.Slice(unmatched))
+	}
+}
+
+// deckExtension returns the extension of a deck file, including any
+// compression extension, so split decks keep the format of their input.
+// my.deck.csv.gz has the extension .csv.gz.
+func deckExtension(path string) string {
+	if path == file.Stdin {
+		return ".csv"
+	}
+	compressed := file.CompressedExt(path)
+	ext := filepath.Ext(strings.TrimSuffix(path, compressed))
+	if ext == "" {
+		ext = ".csv"
+	}
+	return ext + compressed
+}
+
+// safeFileName replaces characters that can't be used in file names, like
+// the colons of hierarchical tags, with underscores.
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
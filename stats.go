@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/stats"
+)
+
+// deckStats prints an overview of a deck's contents.
+func deckStats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	format := flags.String("format", "text", "output format, text or json")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("Unknown format %s, expected text or json", *format)
+	}
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file")
+	}
+
+	files, opts := input.expand(flags.Args())
+	loaded, err := file.LoadAll(files, opts, *jobs)
+	if err != nil {
+		log.Fatalf("Error loading files: %s", err)
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = file.SourceName(f)
+	}
+	s := stats.Compute(names, loaded, match.matcher)
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(s)
+	} else {
+		err = s.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("Error writing stats: %s", err)
+	}
+}
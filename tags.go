@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"runtime"
+
+	"github.com/nrb/csvmerger/pkg/file"
+	"github.com/nrb/csvmerger/pkg/stream"
+	"github.com/nrb/csvmerger/pkg/tagrules"
+)
+
+// tags runs one of the tag subcommands.
+func tags(args []string) {
+	if len(args) < 1 {
+		log.Fatalf("Need a tags subcommand, like rewrite")
+	}
+	switch args[0] {
+	case "rewrite":
+		tagsRewrite(args[1:])
+	default:
+		log.Fatalf("Unknown tags subcommand %s", args[0])
+	}
+}
+
+// tagsRewrite applies a tag rules file to decks, either writing the merged
+// result or rewriting each file in place. Files are only replaced once
+// they've been written in full.
+func tagsRewrite(args []string) {
+	flags := flag.NewFlagSet("tags rewrite", flag.ExitOnError)
+	rulesPath := flags.String("rules", "", "tag rules file to apply")
+	inPlace := flags.Bool("in-place", false, "rewrite each file in place instead of writing a merged deck")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "number of files to load at once")
+	output := addOutputFlags(flags)
+	input := addInputFlags(flags)
+	match := addMatchFlag(flags)
+	flags.Parse(args)
+
+	if *rulesPath == "" {
+		log.Fatalf("Need a -rules file")
+	}
+	if flagSet(flags, "tag-rules") {
+		log.Fatalf("Give the rules to apply with -rules, not -tag-rules")
+	}
+	if flags.NArg() < 1 {
+		log.Fatalf("Need at least 1 file to rewrite")
+	}
+	if *inPlace && flagSet(flags, "o") {
+		log.Fatalf("Can't use -o with -in-place, which rewrites each file")
+	}
+	rules, err := tagrules.Load(*rulesPath)
+	if err != nil {
+		log.Fatalf("Error loading rules: %s", err)
+	}
+
+	files, opts := input.expand(flags.Args())
+	opts.Rules = rules
+	if !*inPlace {
+		output.write(stream.Slice(mergeFiles(files, opts, match.matcher, *jobs)))
+		return
+	}
+
+	for _, path := range files {
+		if path == file.Stdin {
+			log.Fatalf("Can't rewrite standard input in place")
+		}
+	}
+	loaded, err := file.LoadAll(files, opts, *jobs)
+	if err != nil {
+		log.Fatalf("Error loading files: %s", err)
+	}
+	for i, path := range files {
+		output.replaceFile(path, stream.Slice(loaded[i]))
+	}
+}